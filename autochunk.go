@@ -0,0 +1,134 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync/atomic"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Execution time of a chunk for which the scheduling overhead of the chunk
+// is negligible
+const autoChunkTarget = 200*time.Microsecond
+
+// State of a range job with automatic chunk size. Threads take chunks of
+// the current size from the range until it is exhausted, and the size is
+// adapted after each chunk
+type autoChunks struct {
+  // next iteration and chunk size, accessed atomically
+  next int64
+  size int64
+  // maximum chunk size, which leaves enough chunks for balancing
+  // the load
+  max  int64
+  end  int64
+}
+
+// Returns the next chunk or false if the range is exhausted
+func (obj *autoChunks) take() (int, int, bool) {
+  size := atomic.LoadInt64(&obj.size)
+  from := atomic.AddInt64(&obj.next, size) - size
+  if from >= obj.end {
+    return 0, 0, false
+  }
+  to := from + size
+  if to > obj.end {
+    to = obj.end
+  }
+  return int(from), int(to), true
+}
+
+// Adapt the chunk size to the execution time [d] of [n] iterations. The
+// size at most doubles per chunk, starting with single iterations
+func (obj *autoChunks) observe(n int, d time.Duration) {
+  size := atomic.LoadInt64(&obj.size)
+  next := obj.max
+  if d > 0 {
+    next = int64(float64(n)*float64(autoChunkTarget)/float64(d))
+  }
+  if next > 2*size {
+    next = 2*size
+  }
+  if next > obj.max {
+    next = obj.max
+  }
+  if next < 1 {
+    next = 1
+  }
+  atomic.CompareAndSwapInt64(&obj.size, size, next)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Submit a range job whose chunk size is chosen automatically. Chunks
+// start with single iterations and grow until the execution time of a
+// chunk amortizes the cost of scheduling it, while enough chunks remain to
+// balance the load between threads. This removes the need to tune the
+// number of iterations per job for loops with cheap iterations
+func (t ThreadPool) AddAutoRangeJob(iFrom, iTo int, jobGroup int, f func(i int, pool ThreadPool, erf func() error) error) error {
+  if iFrom >= iTo {
+    return nil
+  }
+  m := t.NumberOfThreads()
+  if m > iTo-iFrom {
+    m = iTo-iFrom
+  }
+  s := autoChunks{next: int64(iFrom), size: 1, end: int64(iTo)}
+  if s.max = int64((iTo-iFrom)/(4*m)); s.max < 1 {
+    s.max = 1
+  }
+  fs := make([]func(pool ThreadPool, erf func() error) error, m)
+  for k := range fs {
+    fs[k] = func(pool ThreadPool, erf func() error) error {
+      for {
+        // stop taking chunks once a job of the group failed
+        if erf() != nil {
+          return nil
+        }
+        iFrom, iTo, ok := s.take()
+        if !ok {
+          return nil
+        }
+        start := time.Now()
+        for i := iFrom; i < iTo; i++ {
+          if err := f(i, pool, erf); err != nil {
+            return rangeError{i, err}
+          }
+        }
+        s.observe(iTo-iFrom, time.Since(start))
+      }
+    }
+  }
+  return t.addJobs(jobGroup, fs)
+}
+
+// Same as RangeJob, but the chunk size is chosen automatically (see
+// AddAutoRangeJob)
+func (t ThreadPool) AutoRangeJob(iFrom, iTo int, f func(i int, pool ThreadPool, erf func() error) error) error {
+  g := t.NewJobGroup()
+  if err := t.AddAutoRangeJob(iFrom, iTo, g, f); err != nil {
+    return err
+  }
+  return t.Wait(g)
+}
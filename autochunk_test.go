@@ -0,0 +1,81 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "sync/atomic"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestAutoRangeJob(t *testing.T) {
+
+  for _, n := range []int{1, 4} {
+    p := New(n, 100)
+    r := make([]int32, 100000)
+    if err := p.AutoRangeJob(0, len(r), func(i int, pool ThreadPool, erf func() error) error {
+      atomic.AddInt32(&r[i], 1)
+      return nil
+    }); err != nil {
+      t.Error(err)
+    }
+    for i := range r {
+      if r[i] != 1 {
+        t.Errorf("test failed: %d", i); break
+      }
+    }
+    e := errors.New("failed")
+    if err := p.AutoRangeJob(0, 1000, func(i int, pool ThreadPool, erf func() error) error {
+      if i == 500 {
+        return e
+      }
+      return nil
+    }); !errors.Is(err, e) {
+      t.Errorf("test failed: %v", err)
+    }
+    p.Stop()
+  }
+}
+
+func TestAutoChunks(t *testing.T) {
+
+  s := autoChunks{size: 1, max: 1000, end: 10000}
+  // cheap iterations, the size at most doubles
+  s.observe(1, time.Microsecond)
+  if s.size != 2 {
+    t.Errorf("test failed: %d", s.size)
+  }
+  for i := 0; i < 20; i++ {
+    s.observe(int(s.size), time.Duration(s.size)*time.Microsecond)
+  }
+  if s.size != 200 {
+    t.Errorf("test failed: %d", s.size)
+  }
+  // expensive iterations
+  s.observe(int(s.size), time.Duration(s.size)*time.Millisecond)
+  if s.size != 1 {
+    t.Errorf("test failed: %d", s.size)
+  }
+}
@@ -0,0 +1,87 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+// A reusable barrier for the chunks of gang jobs. Parties join when a gang
+// job is dispatched and leave when their chunk returns, so that chunks which
+// fail before reaching the barrier do not block the remaining chunks
+type barrier struct {
+  mtx     sync.Mutex
+  parties int
+  count   int
+  release chan struct{}
+}
+
+func (b *barrier) join(n int) {
+  b.mtx.Lock()
+  defer b.mtx.Unlock()
+  b.parties += n
+}
+
+func (b *barrier) leave() {
+  b.mtx.Lock()
+  defer b.mtx.Unlock()
+  b.parties -= 1
+  b.releaseLocked()
+}
+
+func (b *barrier) releaseLocked() {
+  if b.count > 0 && b.count >= b.parties {
+    close(b.release)
+    b.release = nil
+    b.count   = 0
+  }
+}
+
+func (b *barrier) wait() {
+  b.mtx.Lock()
+  if b.release == nil {
+    b.release = make(chan struct{})
+  }
+  r := b.release
+  b.count += 1
+  b.releaseLocked()
+  b.mtx.Unlock()
+  <-r
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Block until all running chunks of gang jobs in [jobGroup] have reached the
+// barrier. Chunks that return before reaching the barrier are no longer
+// waited for. The barrier is reusable, i.e. it can be called once per
+// iteration of an iterative algorithm. It returns immediately if no gang job
+// of [jobGroup] is running
+func (t ThreadPool) Barrier(jobGroup int) {
+  if t.threadPool == nil {
+    return
+  }
+  if state, ok := t.lookupJobGroup(jobGroup); ok {
+    state.barrier.wait()
+  }
+}
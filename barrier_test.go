@@ -0,0 +1,77 @@
+/* Copyright (C) 2017-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "fmt"
+import "sync/atomic"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestBarrier(t *testing.T) {
+
+  p := New(5, 100)
+  g := p.NewJobGroup()
+
+  // all chunks must finish iteration k before any chunk starts k+1
+  n := int32(0)
+  if err := p.AddGangJob(0, 4, g, func(iFrom, iTo int, pool ThreadPool, erf func() error) error {
+    for k := 0; k < 100; k++ {
+      atomic.AddInt32(&n, 1)
+      pool.Barrier(g)
+      if r := atomic.LoadInt32(&n); r < int32(4*(k+1)) {
+        return fmt.Errorf("barrier failed in iteration %d", k)
+      }
+      pool.Barrier(g)
+    }
+    return nil
+  }); err != nil {
+    t.Error(err)
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestBarrierLeave(t *testing.T) {
+
+  p := New(5, 100)
+  g := p.NewJobGroup()
+
+  // a chunk that fails before reaching the barrier must
+  // not block the remaining chunks
+  p.AddGangJob(0, 4, g, func(iFrom, iTo int, pool ThreadPool, erf func() error) error {
+    if iFrom == 0 {
+      return fmt.Errorf("chunk failed")
+    }
+    pool.Barrier(g)
+    return nil
+  })
+  if err := p.Wait(g); err == nil {
+    t.Error("test failed")
+  }
+  // barrier without gang job
+  ThreadPool{}.Barrier(0)
+  p.Barrier(p.NewJobGroup())
+}
@@ -0,0 +1,167 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "io/ioutil"
+import "math"
+import "path/filepath"
+import "runtime"
+import "strconv"
+import "strings"
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+var cpuQuota struct {
+  once  sync.Once
+  quota float64
+  ok    bool
+}
+
+// Returns the number of threads of pools that are created with zero
+// threads, which is GOMAXPROCS limited by the CPU quota of the cgroup of
+// the process (cgroups v1 and v2). Hence, pools in containers with a CPU
+// limit do not start more workers than CPUs are available
+func DefaultThreads() int {
+  cpuQuota.once.Do(func() {
+    cpuQuota.quota, cpuQuota.ok = cgroupQuota("/proc/self/cgroup", "/sys/fs/cgroup")
+  })
+  n := runtime.GOMAXPROCS(0)
+  if cpuQuota.ok {
+    if m := int(math.Ceil(cpuQuota.quota)); m < n {
+      n = m
+    }
+  }
+  if n < 1 {
+    n = 1
+  }
+  return n
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Returns the CPU quota in number of CPUs of the cgroup listed in [cgroup],
+// where cgroup file systems are mounted at [root]. The smallest quota of
+// the cgroup and its parents is returned. The second return value is
+// false if no quota is set
+func cgroupQuota(cgroup, root string) (float64, bool) {
+  buf, err := ioutil.ReadFile(cgroup)
+  if err != nil {
+    return 0, false
+  }
+  quota := math.Inf(1)
+  for _, line := range strings.Split(string(buf), "\n") {
+    // hierarchy-ID:controller-list:cgroup-path
+    fields := strings.SplitN(line, ":", 3)
+    if len(fields) != 3 {
+      continue
+    }
+    var dirs []string
+    var read func(string) (float64, bool)
+    switch {
+    case fields[0] == "0" && fields[1] == "":
+      // cgroups v2, use the unified hierarchy
+      dirs = []string{root}
+      read = readCpuMax
+    case hasController(fields[1], "cpu"):
+      // cgroups v1, the controller is mounted either separately or
+      // jointly with cpuacct
+      dirs = []string{filepath.Join(root, "cpu"), filepath.Join(root, "cpu,cpuacct"), filepath.Join(root, fields[1])}
+      read = readCfsQuota
+    default:
+      continue
+    }
+    for _, dir := range dirs {
+      // within a cgroup namespace the path of the cgroup is the root
+      // of the mount
+      for p := filepath.Join(dir, fields[2]); ; p = filepath.Dir(p) {
+        if q, ok := read(p); ok && q < quota {
+          quota = q
+        }
+        if p == dir || len(p) <= len(dir) {
+          break
+        }
+      }
+    }
+  }
+  if math.IsInf(quota, 1) {
+    return 0, false
+  }
+  return quota, true
+}
+
+func hasController(controllers, name string) bool {
+  for _, c := range strings.Split(controllers, ",") {
+    if c == name {
+      return true
+    }
+  }
+  return false
+}
+
+// Read the quota of a cgroups v2 directory, where cpu.max contains
+// the quota and the period, or "max" if no quota is set
+func readCpuMax(dir string) (float64, bool) {
+  buf, err := ioutil.ReadFile(filepath.Join(dir, "cpu.max"))
+  if err != nil {
+    return 0, false
+  }
+  fields := strings.Fields(string(buf))
+  if len(fields) == 0 || fields[0] == "max" {
+    return 0, false
+  }
+  period := 100000.0
+  if len(fields) > 1 {
+    if period, err = strconv.ParseFloat(fields[1], 64); err != nil {
+      return 0, false
+    }
+  }
+  return parseQuota(fields[0], period)
+}
+
+// Read the quota of a cgroups v1 directory, where a quota of -1
+// indicates that no quota is set
+func readCfsQuota(dir string) (float64, bool) {
+  q, err := ioutil.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+  if err != nil {
+    return 0, false
+  }
+  p, err := ioutil.ReadFile(filepath.Join(dir, "cpu.cfs_period_us"))
+  if err != nil {
+    return 0, false
+  }
+  period, err := strconv.ParseFloat(strings.TrimSpace(string(p)), 64)
+  if err != nil {
+    return 0, false
+  }
+  return parseQuota(strings.TrimSpace(string(q)), period)
+}
+
+func parseQuota(s string, period float64) (float64, bool) {
+  quota, err := strconv.ParseFloat(s, 64)
+  if err != nil || quota <= 0 || period <= 0 {
+    return 0, false
+  }
+  return quota/period, true
+}
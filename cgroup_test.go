@@ -0,0 +1,86 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "io/ioutil"
+import "os"
+import "path/filepath"
+import "runtime"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func writeCgroupFiles(t *testing.T, root string, files map[string]string) {
+  for name, content := range files {
+    path := filepath.Join(root, name)
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+      t.Fatal(err)
+    }
+    if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+      t.Fatal(err)
+    }
+  }
+}
+
+func TestCgroupQuota(t *testing.T) {
+
+  root, err := ioutil.TempDir("", "cgroup")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(root)
+
+  writeCgroupFiles(t, root, map[string]string{
+    // cgroups v2, the parent has the smaller quota
+    "v2/cgroup"                                  : "0::/pod/container\n",
+    "v2/fs/cpu.max"                              : "max 100000\n",
+    "v2/fs/pod/cpu.max"                          : "150000 100000\n",
+    "v2/fs/pod/container/cpu.max"                : "400000 100000\n",
+    // cgroups v1
+    "v1/cgroup"                                  : "5:memory:/docker\n4:cpu,cpuacct:/docker\n",
+    "v1/fs/cpu,cpuacct/docker/cpu.cfs_quota_us"  : "200000\n",
+    "v1/fs/cpu,cpuacct/docker/cpu.cfs_period_us" : "100000\n",
+    // no quota
+    "none/cgroup"                                : "0::/\n",
+    "none/fs/cpu.max"                            : "max 100000\n",
+  })
+  if q, ok := cgroupQuota(filepath.Join(root, "v2/cgroup"), filepath.Join(root, "v2/fs")); !ok || q != 1.5 {
+    t.Errorf("test failed: %v %v", q, ok)
+  }
+  if q, ok := cgroupQuota(filepath.Join(root, "v1/cgroup"), filepath.Join(root, "v1/fs")); !ok || q != 2 {
+    t.Errorf("test failed: %v %v", q, ok)
+  }
+  if _, ok := cgroupQuota(filepath.Join(root, "none/cgroup"), filepath.Join(root, "none/fs")); ok {
+    t.Error("test failed")
+  }
+  if _, ok := cgroupQuota(filepath.Join(root, "missing"), root); ok {
+    t.Error("test failed")
+  }
+}
+
+func TestDefaultThreads(t *testing.T) {
+  if n := DefaultThreads(); n < 1 || n > runtime.GOMAXPROCS(0) {
+    t.Errorf("test failed: %d", n)
+  }
+}
@@ -0,0 +1,95 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "bytes"
+import "io"
+import "os"
+
+/* -------------------------------------------------------------------------- */
+
+// Returns the first record boundary at or after [pos], i.e. the position
+// following the next [delim] that occurs at or after [pos]-1
+func recordBoundary(r io.ReaderAt, size, pos int64, delim byte) (int64, error) {
+  if pos <= 0 {
+    return 0, nil
+  }
+  buf := make([]byte, 4096)
+  for pos -= 1; pos < size; {
+    n, err := r.ReadAt(buf, pos)
+    if i := bytes.IndexByte(buf[:n], delim); i >= 0 {
+      return pos+int64(i)+1, nil
+    }
+    pos += int64(n)
+    if err == io.EOF {
+      break
+    }
+    if err != nil {
+      return 0, err
+    }
+  }
+  return size, nil
+}
+
+// Split the first [size] bytes of [r] into [n] chunks of roughly equal size
+// and process them in parallel with a range job. Chunk boundaries are moved
+// forward to the next record boundary, i.e. each chunk starts after the
+// delimiter [delim] and records, for instance lines with delimiter '\n',
+// are never split. Empty chunks are skipped, hence [f] may be called less
+// than [n] times. If [n] is not positive, the number of threads is used
+func ReadChunks(pool ThreadPool, r io.ReaderAt, size int64, n int, delim byte, f func(i int, chunk *io.SectionReader, pool ThreadPool) error) error {
+  if n < 1 {
+    n = pool.NumberOfThreads()
+  }
+  offsets := []int64{0}
+  for k := 1; k < n; k++ {
+    pos, err := recordBoundary(r, size, int64(k)*size/int64(n), delim)
+    if err != nil {
+      return err
+    }
+    if pos > offsets[len(offsets)-1] && pos < size {
+      offsets = append(offsets, pos)
+    }
+  }
+  if size > 0 {
+    offsets = append(offsets, size)
+  }
+  return pool.RangeJob(0, len(offsets)-1, func(i int, pool ThreadPool, erf func() error) error {
+    return f(i, io.NewSectionReader(r, offsets[i], offsets[i+1]-offsets[i]), pool)
+  })
+}
+
+// Same as ReadChunks for the file [name]
+func ReadFileChunks(pool ThreadPool, name string, n int, delim byte, f func(i int, chunk *io.SectionReader, pool ThreadPool) error) error {
+  file, err := os.Open(name)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+  info, err := file.Stat()
+  if err != nil {
+    return err
+  }
+  return ReadChunks(pool, file, info.Size(), n, delim, f)
+}
@@ -0,0 +1,83 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "bufio"
+import "fmt"
+import "io"
+import "io/ioutil"
+import "os"
+import "strings"
+import "sync/atomic"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestReadChunks(t *testing.T) {
+
+  p := New(4, 100)
+  defer p.Stop()
+
+  s := strings.Builder{}
+  for i := 0; i < 1000; i++ {
+    fmt.Fprintf(&s, "record %d\n", i)
+  }
+  r := strings.NewReader(s.String())
+
+  for _, n := range []int{0, 1, 7, 5000} {
+    records := int64(0)
+    chunks  := int64(0)
+    if err := ReadChunks(p, r, r.Size(), n, '\n', func(i int, chunk *io.SectionReader, pool ThreadPool) error {
+      atomic.AddInt64(&chunks, 1)
+      scanner := bufio.NewScanner(chunk)
+      for scanner.Scan() {
+        if !strings.HasPrefix(scanner.Text(), "record ") {
+          return fmt.Errorf("record was split: %q", scanner.Text())
+        }
+        atomic.AddInt64(&records, 1)
+      }
+      return scanner.Err()
+    }); err != nil {
+      t.Error(err)
+    }
+    if records != 1000 || n > 0 && n <= 1000 && chunks != int64(n) {
+      t.Errorf("test failed: %d %d", records, chunks)
+    }
+  }
+  file, err := ioutil.TempFile("", "records")
+  if err != nil {
+    t.Fatal(err)
+  }
+  name := file.Name()
+  defer os.Remove(name)
+  file.WriteString(s.String())
+  file.Close()
+  size := int64(0)
+  if err := ReadFileChunks(p, name, 3, '\n', func(i int, chunk *io.SectionReader, pool ThreadPool) error {
+    atomic.AddInt64(&size, chunk.Size())
+    return nil
+  }); err != nil || size != int64(s.Len()) {
+    t.Errorf("test failed: %v %d", err, size)
+  }
+}
@@ -0,0 +1,105 @@
+//go:build go1.18
+// +build go1.18
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sort"
+
+/* -------------------------------------------------------------------------- */
+
+// Collects items appended by the jobs of a job group without locking.
+// Each thread appends to its own buffer, and the buffers are concatenated
+// by Wait (requires Go 1.18)
+type Collector[T any] struct {
+  pool     ThreadPool
+  jobGroup int
+  buffers  []collectorBuffer[T]
+}
+
+type collectorBuffer[T any] struct {
+  items  []T
+  chunks []collectorChunk[T]
+  // avoid false sharing between threads
+  _      [64]byte
+}
+
+type collectorChunk[T any] struct {
+  index int
+  items []T
+}
+
+// Returns a collector for items appended by jobs of [jobGroup]
+func NewCollector[T any](pool ThreadPool, jobGroup int) *Collector[T] {
+  return &Collector[T]{pool: pool, jobGroup: jobGroup, buffers: make([]collectorBuffer[T], pool.NumberOfThreads())}
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Append [items] to the buffer of the thread that executes the job, where
+// [pool] is the handle passed to the job
+func (c *Collector[T]) Append(pool ThreadPool, items ...T) {
+  b := &c.buffers[pool.GetThreadId()]
+  b.items = append(b.items, items...)
+}
+
+// Append [items] that belong to chunk [index], for instance the index of
+// a range chunk. Wait returns the items of all chunks ordered by their
+// index, independent of the threads that appended them
+func (c *Collector[T]) AppendChunk(pool ThreadPool, index int, items ...T) {
+  b := &c.buffers[pool.GetThreadId()]
+  if n := len(b.chunks); n > 0 && b.chunks[n-1].index == index {
+    b.chunks[n-1].items = append(b.chunks[n-1].items, items...)
+  } else {
+    b.chunks = append(b.chunks, collectorChunk[T]{index: index, items: append([]T(nil), items...)})
+  }
+}
+
+// Wait for the job group and return all collected items. Items appended
+// with Append come first in the order of thread ids, followed by the
+// items appended with AppendChunk in the order of chunk indices. The
+// buffers are cleared, so that the collector can be reused
+func (c *Collector[T]) Wait() ([]T, error) {
+  err    := c.pool.Wait(c.jobGroup)
+  n      := 0
+  chunks := []collectorChunk[T]{}
+  for i := range c.buffers {
+    n += len(c.buffers[i].items)
+    for _, chunk := range c.buffers[i].chunks {
+      n += len(chunk.items)
+    }
+    chunks = append(chunks, c.buffers[i].chunks...)
+  }
+  sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].index < chunks[j].index })
+  r := make([]T, 0, n)
+  for i := range c.buffers {
+    r = append(r, c.buffers[i].items...)
+    c.buffers[i] = collectorBuffer[T]{}
+  }
+  for _, chunk := range chunks {
+    r = append(r, chunk.items...)
+  }
+  return r, err
+}
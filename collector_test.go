@@ -0,0 +1,75 @@
+//go:build go1.18
+// +build go1.18
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sort"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestCollector(t *testing.T) {
+
+  for _, n := range []int{1, 3} {
+    p := New(n, 100)
+    g := p.NewJobGroup()
+    c := NewCollector[int](p, g)
+
+    // filter even numbers
+    p.AddRangeJob(0, 1000, g, func(i int, pool ThreadPool, erf func() error) error {
+      if i % 2 == 0 {
+        c.Append(pool, i)
+      }
+      return nil
+    })
+    r, err := c.Wait()
+    if err != nil {
+      t.Error(err)
+    }
+    sort.Ints(r)
+    if len(r) != 500 || r[0] != 0 || r[499] != 998 {
+      t.Errorf("test failed: %v", r)
+    }
+
+    // chunks are merged in the order of their index
+    p.AddRangeJob_(0, 1000, g, func(iFrom, iTo int, pool ThreadPool, erf func() error) error {
+      for i := iFrom; i < iTo; i++ {
+        if i % 2 == 0 {
+          c.AppendChunk(pool, iFrom, i)
+        }
+      }
+      return nil
+    })
+    r, err = c.Wait()
+    if err != nil {
+      t.Error(err)
+    }
+    if len(r) != 500 || !sort.IntsAreSorted(r) {
+      t.Errorf("test failed: %v", r)
+    }
+    p.Stop()
+  }
+}
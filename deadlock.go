@@ -0,0 +1,80 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+// Job groups with jobs that wait for other job groups. Since Wait returns
+// only once all jobs of a group are done, a cycle in this graph is a
+// deadlock
+type waitGraph struct {
+  mtx   sync.Mutex
+  // number of jobs of a group that wait for another group
+  edges map[int]map[int]int
+}
+
+// Record that a job of group [from] waits for group [to]. Returns false
+// if this would close a cycle
+func (obj *waitGraph) add(from, to int) bool {
+  obj.mtx.Lock()
+  defer obj.mtx.Unlock()
+  if obj.reachable(to, from, map[int]bool{}) {
+    return false
+  }
+  if obj.edges == nil {
+    obj.edges = make(map[int]map[int]int)
+  }
+  if obj.edges[from] == nil {
+    obj.edges[from] = make(map[int]int)
+  }
+  obj.edges[from][to] += 1
+  return true
+}
+
+func (obj *waitGraph) remove(from, to int) {
+  obj.mtx.Lock()
+  defer obj.mtx.Unlock()
+  if obj.edges[from][to] -= 1; obj.edges[from][to] == 0 {
+    delete(obj.edges[from], to)
+    if len(obj.edges[from]) == 0 {
+      delete(obj.edges, from)
+    }
+  }
+}
+
+// True if group [to] can be reached from [from]
+func (obj *waitGraph) reachable(from, to int, visited map[int]bool) bool {
+  if from == to {
+    return true
+  }
+  visited[from] = true
+  for next := range obj.edges[from] {
+    if !visited[next] && obj.reachable(next, to, visited) {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,71 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestDeadlock(t *testing.T) {
+
+  p := New(3, 100)
+  defer p.Stop()
+
+  // job waits for its own group
+  g := p.NewJobGroup()
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    return pool.Wait(g)
+  })
+  if err := p.Wait(g); !errors.Is(err, ErrDeadlock) {
+    t.Errorf("test failed: %v", err)
+  }
+  // cycle of two groups
+  g1 := p.NewJobGroup()
+  g2 := p.NewJobGroup()
+  p.AddJob(g1, func(pool ThreadPool, erf func() error) error {
+    return pool.AddJob(g2, func(pool ThreadPool, erf func() error) error {
+      return pool.Wait(g1)
+    })
+  })
+  p.AddJob(g1, func(pool ThreadPool, erf func() error) error {
+    return pool.Wait(g2)
+  })
+  if err := p.Wait(g1); !errors.Is(err, ErrDeadlock) {
+    t.Errorf("test failed: %v", err)
+  }
+  p.Wait(g2)
+  // nested waits without cycle
+  g3 := p.NewJobGroup()
+  p.AddJob(g3, func(pool ThreadPool, erf func() error) error {
+    g4 := pool.NewJobGroup()
+    pool.AddJob(g4, func(pool ThreadPool, erf func() error) error {
+      return nil
+    })
+    return pool.Wait(g4)
+  })
+  if err := p.Wait(g3); err != nil {
+    t.Error(err)
+  }
+}
@@ -0,0 +1,131 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "fmt"
+import "io"
+import "net/http"
+import "sort"
+import "sync/atomic"
+import "text/tabwriter"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Job that is currently executed by a thread
+type threadActivity struct {
+  jobGroup int64
+  // start time in nanoseconds since the epoch, zero if idle
+  start    int64
+  // total execution time of jobs in nanoseconds
+  busy     int64
+  // number of nested jobs
+  depth    int32
+}
+
+// Record the start of a job and return the previous state, which is
+// restored once the job is done. Jobs may be nested if a job waits for
+// another group
+func (a *threadActivity) set(jobGroup int, start time.Time) (int64, int64) {
+  g := atomic.SwapInt64(&a.jobGroup, int64(jobGroup))
+  s := atomic.SwapInt64(&a.start, start.UnixNano())
+  atomic.AddInt32(&a.depth, 1)
+  return g, s
+}
+
+func (a *threadActivity) restore(jobGroup, start int64) {
+  if start == 0 {
+    // outermost job is done
+    atomic.AddInt64(&a.busy, time.Now().UnixNano() - atomic.LoadInt64(&a.start))
+  }
+  atomic.StoreInt64(&a.start, start)
+  atomic.StoreInt64(&a.jobGroup, jobGroup)
+  atomic.AddInt32(&a.depth, -1)
+}
+
+func (a *threadActivity) get() (int, time.Time, bool) {
+  s := atomic.LoadInt64(&a.start)
+  g := atomic.LoadInt64(&a.jobGroup)
+  if s == 0 {
+    return 0, time.Time{}, false
+  }
+  return int(g), time.Unix(0, s), true
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Returns a handler that renders the current state of the pool as plain
+// text, i.e. the activity of all threads, the length of the queue, the
+// number of pending jobs and errors of all job groups, and the running jobs
+// ordered by their execution time. The handler can be registered for live
+// debugging, for instance at /debug/threadpool
+func (t ThreadPool) DebugHandler() http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    t.writeDebug(w)
+  })
+}
+
+func (t ThreadPool) writeDebug(w io.Writer) {
+  snapshot := t.Snapshot()
+  fmt.Fprintf(w, "threads: %d\n", len(snapshot.Threads))
+  fmt.Fprintf(w, "queue  : %d/%d\n", snapshot.Queue, snapshot.Capacity)
+
+  threads := snapshot.Threads
+  tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+  fmt.Fprintf(w, "\nthreads:\n")
+  fmt.Fprintf(tw, "thread\tgroup\tstate\n")
+  for _, s := range threads {
+    if s.Running {
+      fmt.Fprintf(tw, "%d\t%d\trunning for %v\n", s.Id, s.JobGroup, snapshot.Time.Sub(s.Since))
+    } else {
+      fmt.Fprintf(tw, "%d\t-\tidle\n", s.Id)
+    }
+  }
+  tw.Flush()
+
+  fmt.Fprintf(w, "\ngroups:\n")
+  fmt.Fprintf(tw, "group\tpending\terror\n")
+  for _, s := range snapshot.Groups {
+    if s.Error != "" {
+      fmt.Fprintf(tw, "%d\t%d\t%s\n", s.JobGroup, s.Pending, s.Error)
+    } else {
+      fmt.Fprintf(tw, "%d\t%d\t-\n", s.JobGroup, s.Pending)
+    }
+  }
+  tw.Flush()
+
+  // slowest running jobs first
+  sort.SliceStable(threads, func(i, j int) bool {
+    return threads[i].Running && (!threads[j].Running || threads[i].Since.Before(threads[j].Since))
+  })
+  fmt.Fprintf(w, "\nslowest running jobs:\n")
+  fmt.Fprintf(tw, "thread\tgroup\tduration\n")
+  for _, s := range threads {
+    if s.Running {
+      fmt.Fprintf(tw, "%d\t%d\t%v\n", s.Id, s.JobGroup, snapshot.Time.Sub(s.Since))
+    }
+  }
+  tw.Flush()
+}
@@ -0,0 +1,60 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "fmt"
+import "net/http/httptest"
+import "strings"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestDebugHandler(t *testing.T) {
+
+  p := New(3, 100)
+  g := p.NewJobGroup()
+
+  started := make(chan struct{})
+  release := make(chan struct{})
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    close(started)
+    <- release
+    return fmt.Errorf("test error")
+  })
+  <- started
+
+  w := httptest.NewRecorder()
+  p.DebugHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/threadpool", nil))
+  if s := w.Body.String(); !strings.Contains(s, "running for") {
+    t.Errorf("test failed: %s", s)
+  }
+  close(release)
+  p.Wait(g)
+
+  w = httptest.NewRecorder()
+  Nil().DebugHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/threadpool", nil))
+  if s := w.Body.String(); !strings.HasPrefix(s, "threads: 1\n") {
+    t.Errorf("test failed: %s", s)
+  }
+}
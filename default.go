@@ -0,0 +1,62 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+var defaultPool struct {
+  once sync.Once
+  pool ThreadPool
+}
+
+// Returns a process-wide pool with DefaultThreads() threads, which is created on
+// first use. Libraries may use this pool instead of creating their own,
+// so that the number of threads is not multiplied
+func Default() ThreadPool {
+  defaultPool.once.Do(func() {
+    n := DefaultThreads()
+    defaultPool.pool = New(n, 100*n)
+  })
+  return defaultPool.pool
+}
+
+// Submit a single job to the default pool. The returned function waits
+// until the job is done and returns its error
+func Go(f func(pool ThreadPool, erf func() error) error) func() error {
+  pool := Default()
+  g    := pool.NewJobGroup()
+  if err := pool.AddJob(g, f); err != nil {
+    return func() error { return err }
+  }
+  return func() error {
+    return pool.Wait(g)
+  }
+}
+
+// Submit a range job to the default pool and wait until it is done
+func Range(iFrom, iTo int, f func(i int, pool ThreadPool, erf func() error) error) error {
+  return Default().RangeJob(iFrom, iTo, f)
+}
@@ -0,0 +1,54 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "fmt"
+import "sync/atomic"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestDefault(t *testing.T) {
+
+  if Default().threadPool != Default().threadPool {
+    t.Error("test failed")
+  }
+  n    := int32(0)
+  wait := Go(func(pool ThreadPool, erf func() error) error {
+    atomic.AddInt32(&n, 1)
+    return fmt.Errorf("test error")
+  })
+  if err := wait(); err == nil || n != 1 {
+    t.Error("test failed")
+  }
+  if err := Range(0, 100, func(i int, pool ThreadPool, erf func() error) error {
+    atomic.AddInt32(&n, 1)
+    return nil
+  }); err != nil {
+    t.Error(err)
+  }
+  if n != 101 {
+    t.Error("test failed")
+  }
+}
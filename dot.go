@@ -0,0 +1,67 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "bufio"
+import "fmt"
+import "io"
+import "strings"
+
+/* -------------------------------------------------------------------------- */
+
+// Write the graph of job groups in DOT format, where an edge connects the
+// group of a job with the groups it submitted jobs to. Nodes are labeled
+// with the number of pending jobs, the time since the group was created,
+// and the error of the group. Failed groups are colored red, groups with
+// pending jobs yellow and finished groups green. Groups that were cleared
+// by Wait are not included
+func (t ThreadPool) WriteDot(w io.Writer) error {
+  snapshot := t.Snapshot()
+  writer   := bufio.NewWriter(w)
+  fmt.Fprintf(writer, "digraph threadpool {\n")
+  fmt.Fprintf(writer, "  node [shape=box, style=filled];\n")
+  for _, g := range snapshot.Groups {
+    label := fmt.Sprintf("group %d\\npending: %d\\nage: %v", g.JobGroup, g.Pending, snapshot.Time.Sub(g.Created))
+    color := "palegreen"
+    switch {
+    case g.Error != "":
+      label += "\\nerror: " + escapeDot(g.Error)
+      color  = "salmon"
+    case g.Pending > 0:
+      color  = "khaki"
+    }
+    fmt.Fprintf(writer, "  g%d [label=\"%s\", fillcolor=%s];\n", g.JobGroup, label, color)
+  }
+  for _, g := range snapshot.Groups {
+    if g.HasParent {
+      fmt.Fprintf(writer, "  g%d -> g%d;\n", g.Parent, g.JobGroup)
+    }
+  }
+  fmt.Fprintf(writer, "}\n")
+  return writer.Flush()
+}
+
+func escapeDot(s string) string {
+  return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
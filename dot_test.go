@@ -0,0 +1,55 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "bytes"
+import "fmt"
+import "strings"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestWriteDot(t *testing.T) {
+
+  p  := New(3, 100, KeepState())
+  g1 := p.NewJobGroup()
+  g2 := p.NewJobGroup()
+
+  p.AddJob(g1, func(pool ThreadPool, erf func() error) error {
+    pool.AddJob(g2, func(pool ThreadPool, erf func() error) error {
+      return fmt.Errorf("test \"error\"")
+    })
+    return pool.Wait(g2)
+  })
+  p.Wait(g1)
+
+  buf := bytes.Buffer{}
+  if err := p.WriteDot(&buf); err != nil {
+    t.Fatal(err)
+  }
+  s := buf.String()
+  if !strings.Contains(s, fmt.Sprintf("g%d -> g%d;", g1, g2)) || !strings.Contains(s, `error: test \"error\"`) {
+    t.Errorf("test failed: %s", s)
+  }
+}
@@ -0,0 +1,208 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "fmt"
+import "runtime/debug"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Returned when jobs are submitted to a pool that was stopped, or when
+// waiting for jobs of a stopped pool
+var ErrStopped   = errors.New("threadpool: pool is stopped")
+
+// Returned when a job could not be queued because the queue is full
+var ErrQueueFull = errors.New("threadpool: queue is full")
+
+// Returned when a job was not executed because its job group was
+// cancelled
+var ErrCancelled = errors.New("threadpool: job group cancelled")
+
+// Returned when a job was not submitted because its job group has too
+// many outstanding jobs (see GroupQuota)
+var ErrQuotaExceeded = errors.New("threadpool: job group quota exceeded")
+
+// Returned when a job is submitted to a job group that was not obtained
+// from NewJobGroup (see StrictGroups)
+var ErrUnknownGroup = errors.New("threadpool: unknown job group")
+
+// Returned when a job waits for its own job group, or for a job group
+// that directly or indirectly waits for the group of the job
+var ErrDeadlock  = errors.New("threadpool: deadlock")
+
+// Returned when an operation did not complete in time, i.e. when
+// AddJobTimeout could not queue a job in time
+var ErrTimeout   = errors.New("threadpool: timeout")
+
+// Returned by AddJobTimeout if the queue remained full
+var errQueueTimeout error = queueTimeoutError{}
+
+type queueTimeoutError struct{}
+
+func (err queueTimeoutError) Error() string {
+  return "threadpool: queue is full (timeout)"
+}
+
+func (err queueTimeoutError) Is(target error) bool {
+  return target == ErrQueueFull || target == ErrTimeout
+}
+
+// Matches errors that were created from a panic in a job
+var ErrPanic     = errors.New("threadpool: job panicked")
+
+/* -------------------------------------------------------------------------- */
+
+// Error created from a recovered panic. The stack trace is recorded
+// at the point where the panic occurred
+type PanicError struct {
+  Value interface{}
+  Stack []byte
+}
+
+func (err PanicError) Error() string {
+  return fmt.Sprintf("%v: %v", ErrPanic, err.Value)
+}
+
+func (err PanicError) Unwrap() error {
+  return ErrPanic
+}
+
+// Value of panics that are raised again by Wait with the RePanic option.
+// The message includes the stack trace of the original panic
+type RePanicError struct {
+  PanicError
+}
+
+func (err RePanicError) Error() string {
+  return fmt.Sprintf("%v\n\noriginal stack:\n%s", err.PanicError.Error(), err.Stack)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Returned by Stop if jobs were discarded or job groups had jobs that
+// were still running
+type StopError struct {
+  // number of queued jobs that were discarded
+  Discarded int
+  // job groups with discarded or running jobs
+  Groups    []int
+}
+
+func (err *StopError) Error() string {
+  return fmt.Sprintf("%v: %d jobs discarded, outstanding jobs in groups %v", ErrStopped, err.Discarded, err.Groups)
+}
+
+func (err *StopError) Unwrap() error {
+  return ErrStopped
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Error of a job together with information about its origin
+type JobError struct {
+  Err        error
+  // job group of the job and its name (see SetGroupName)
+  JobGroup   int
+  Name       string
+  // index of the failed iteration for range jobs, otherwise the
+  // position of the job in submission order within its group
+  Index      int
+  // position of the job in submission order within its group
+  Submission int
+  ThreadId   int
+  Time       time.Time
+  // stack of the thread at the time the job returned the error,
+  // only recorded with the ErrorStacks option
+  Stack      []byte
+}
+
+func (err *JobError) Error() string {
+  return err.Err.Error()
+}
+
+func (err *JobError) Unwrap() error {
+  return err.Err
+}
+
+// Returns the origin of an error reported by the pool, i.e. the job that
+// caused the error of a job group. If jobs failed because a nested job
+// failed, the innermost job is returned
+func Cause(err error) (*JobError, bool) {
+  var e *JobError
+  if !errors.As(err, &e) {
+    return nil, false
+  }
+  for inner := e; errors.As(e.Err, &inner); {
+    e = inner
+  }
+  return e, true
+}
+
+// Error of an iteration of a range job, which is converted into a
+// JobError
+type rangeError struct {
+  index int
+  err   error
+}
+
+func (err rangeError) Error() string {
+  return err.err.Error()
+}
+
+func newJobError(err error, j job, threadId int, md Metadata) *JobError {
+  r := JobError{JobGroup: j.jobGroup, Index: j.index, Submission: j.index, ThreadId: threadId, Time: time.Now()}
+  if j.group != nil {
+    r.Name = j.group.getName()
+  }
+  if e, ok := err.(rangeError); ok {
+    r.Index, err = e.index, e.err
+  }
+  r.Err = wrapMetadata(err, md)
+  return &r
+}
+
+// Returns the error of a job that failed because a nested job failed, i.e.
+// [err] already contains the JobError of the nested job. Such errors are
+// not wrapped again, since the nested job describes the origin of the error
+func nestedJobError(err error) (error, bool) {
+  if e, ok := err.(rangeError); ok {
+    err = e.err
+  }
+  var e *JobError
+  return err, errors.As(err, &e)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Call job function and convert panics into errors
+func callJob(f func(ThreadPool, func() error) error, pool ThreadPool, erf func() error) (err error) {
+  defer func() {
+    if r := recover(); r != nil {
+      err = PanicError{Value: r, Stack: debug.Stack()}
+    }
+  }()
+  return f(pool, erf)
+}
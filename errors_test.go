@@ -0,0 +1,222 @@
+/* Copyright (C) 2017-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "bytes"
+import "errors"
+import "fmt"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestErrStopped(t *testing.T) {
+
+  p := New(3, 100)
+  p.Stop()
+
+  if err := p.AddJob(0, func(p ThreadPool, erf func() error) error {
+    return nil
+  }); !errors.Is(err, ErrStopped) {
+    t.Errorf("test failed: %v", err)
+  }
+  if err := p.Wait(0); !errors.Is(err, ErrStopped) {
+    t.Errorf("test failed: %v", err)
+  }
+  // submission never panics, regardless of the queue
+  for _, q := range []ThreadPool{New(3, 0), New(3, 2, LockFreeQueue()), New(3, 100, Serial())} {
+    q.Stop()
+    if err := q.AddRangeJob(0, 10, 0, func(i int, p ThreadPool, erf func() error) error {
+      return nil
+    }); !errors.Is(err, ErrStopped) {
+      t.Errorf("test failed: %v", err)
+    }
+  }
+  // queued jobs are discarded
+  p  = New(3, 100, Manual())
+  g := p.NewJobGroup()
+  n := 0
+  p.AddJob(g, func(p ThreadPool, erf func() error) error {
+    n += 1
+    return nil
+  })
+  m, err := p.Stop()
+  var e *StopError
+  if m != 1 || !errors.As(err, &e) || e.Discarded != 1 || len(e.Groups) != 1 || e.Groups[0] != g {
+    t.Errorf("test failed: %d %v", m, err)
+  }
+  if err := p.Wait(g); !errors.Is(err, ErrStopped) || n != 0 {
+    t.Errorf("test failed: %v", err)
+  }
+  if m, err := p.Stop(); m != 0 || err != nil {
+    t.Errorf("test failed: %d %v", m, err)
+  }
+}
+
+func TestStopErrorGroups(t *testing.T) {
+
+  p  := New(3, 100, Manual(), KeepState())
+  g1 := p.NewJobGroup()
+  g2 := p.NewJobGroup()
+  g3 := p.NewJobGroup()
+
+  // group g2 failed before it lost its queued job
+  p.AddJob(g2, func(p ThreadPool, erf func() error) error {
+    return fmt.Errorf("failed")
+  })
+  p.Step()
+  // group g3 has no outstanding jobs
+  p.AddFunc(g3, func() error { return nil })
+  p.Step()
+  p.AddFunc(g1, func() error { return nil })
+  p.AddFunc(g2, func() error { return nil })
+  _, err := p.Stop()
+  var e *StopError
+  if !errors.As(err, &e) || e.Discarded != 2 || fmt.Sprint(e.Groups) != fmt.Sprint([]int{g1, g2}) {
+    t.Errorf("test failed: %v", err)
+  }
+}
+
+func TestErrPanic(t *testing.T) {
+
+  for _, n := range []int{1, 3} {
+    p := New(n, 100)
+    g := p.NewJobGroup()
+
+    err1 := p.AddJob(g, func(p ThreadPool, erf func() error) error {
+      panic("oops")
+    })
+    err2 := p.Wait(g)
+    if !errors.Is(err1, ErrPanic) && !errors.Is(err2, ErrPanic) {
+      t.Errorf("test failed: %v %v", err1, err2)
+    }
+    p.Stop()
+  }
+}
+
+func TestCause(t *testing.T) {
+
+  f := func(i int, pool ThreadPool, erf func() error) error {
+    if i == 37 {
+      return fmt.Errorf("test error")
+    }
+    return nil
+  }
+  p := New(3, 100)
+  g := p.NewJobGroup()
+  p.AddRangeJob(0, 100, g, f)
+  if e, ok := Cause(p.Wait(g)); !ok || e.Index != 37 || e.Error() != "test error" || e.Time.IsZero() {
+    t.Errorf("test failed: %v", e)
+  }
+  // single threaded pools return the error immediately
+  if e, ok := Cause(Nil().AddRangeJob(0, 100, 0, f)); !ok || e.Index != 37 {
+    t.Errorf("test failed: %v", e)
+  }
+  g = p.NewJobGroup()
+  for i := 0; i < 10; i++ {
+    i := i
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      return f(32+i, pool, erf)
+    })
+  }
+  if e, ok := Cause(p.Wait(g)); !ok || e.Index != 5 {
+    t.Errorf("test failed: %v", e)
+  }
+}
+
+func TestCauseNested(t *testing.T) {
+
+  p := New(3, 100)
+  defer p.Stop()
+
+  g := p.NewJobGroup()
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    return pool.RangeJob(0, 10, func(i int, pool ThreadPool, erf func() error) error {
+      if i == 7 {
+        return fmt.Errorf("test error")
+      }
+      return nil
+    })
+  })
+  err := p.Wait(g)
+  if e, ok := Cause(err); !ok || e.Index != 7 || e.JobGroup == g {
+    t.Errorf("test failed: %v", e)
+  }
+}
+
+func TestRePanic(t *testing.T) {
+
+  p := New(3, 100, RePanic())
+  g := p.NewJobGroup()
+
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    panic("test panic")
+  })
+  defer func() {
+    r := recover()
+    if e, ok := r.(RePanicError); !ok || e.Value != "test panic" || !errors.Is(e, ErrPanic) {
+      t.Errorf("test failed: %v", r)
+    }
+  }()
+  p.Wait(g)
+  t.Error("test failed")
+}
+
+func TestJobErrorGroup(t *testing.T) {
+
+  p := New(3, 100)
+  defer p.Stop()
+
+  g := p.NewJobGroup()
+  p.SetGroupName(g, "tiles")
+  p.AddRangeJob(0, 100, g, func(i int, pool ThreadPool, erf func() error) error {
+    if i == 37 {
+      return fmt.Errorf("test error")
+    }
+    return nil
+  })
+  // the failed iteration belongs to the second chunk
+  var e *JobError
+  if !errors.As(p.Wait(g), &e) || e.JobGroup != g || e.Name != "tiles" || e.Index != 37 || e.Submission != 1 {
+    t.Errorf("test failed: %+v", e)
+  }
+}
+
+func TestErrorStacks(t *testing.T) {
+
+  for _, stacks := range []bool{false, true} {
+    p := New(3, 100)
+    if stacks {
+      p = New(3, 100, ErrorStacks())
+    }
+    g := p.NewJobGroup()
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      return fmt.Errorf("test error")
+    })
+    e, ok := Cause(p.Wait(g))
+    if !ok || stacks != bytes.Contains(e.Stack, []byte("threadpool.(*threadPool).execute")) {
+      t.Errorf("test failed: %s", e.Stack)
+    }
+    p.Stop()
+  }
+}
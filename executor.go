@@ -0,0 +1,78 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+// Adapter for libraries that accept an executor of the form Execute(func())
+// or Submit(func() error) error. All functions are submitted to a single
+// job group of the pool, whose errors are returned by Wait
+type Executor struct {
+  pool GroupPool
+  // first error of a submission by Execute
+  mtx  *sync.Mutex
+  err  *error
+}
+
+// Returns an executor that submits functions to a new job group
+func (t ThreadPool) Executor() Executor {
+  return Executor{pool: t.WithGroup(t.NewJobGroup()), mtx: new(sync.Mutex), err: new(error)}
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Submit [f] to the pool. Panics of [f] are recovered and returned by Wait,
+// as well as errors of the submission
+func (e Executor) Execute(f func()) {
+  if err := e.pool.AddFunc(func() error {
+    f()
+    return nil
+  }); err != nil {
+    e.mtx.Lock()
+    if *e.err == nil {
+      *e.err = err
+    }
+    e.mtx.Unlock()
+  }
+}
+
+// Submit [f] to the pool. The returned error is only concerned with the
+// submission, the error of [f] is returned by Wait
+func (e Executor) Submit(f func() error) error {
+  return e.pool.AddFunc(f)
+}
+
+// Wait until all submitted functions are done and return the first error
+// of a submission by Execute or the error of the job group
+func (e Executor) Wait() error {
+  err := e.pool.Wait()
+  e.mtx.Lock()
+  if *e.err != nil {
+    err, *e.err = *e.err, nil
+  }
+  e.mtx.Unlock()
+  return err
+}
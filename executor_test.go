@@ -0,0 +1,84 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "sync/atomic"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestExecutor(t *testing.T) {
+
+  p := New(3, 100)
+  defer p.Stop()
+
+  // executor shape expected by other libraries
+  var _ interface {
+    Execute(func())
+    Submit(func() error) error
+  } = Executor{}
+
+  e := p.Executor()
+  n := int32(0)
+  for i := 0; i < 10; i++ {
+    e.Execute(func() {
+      atomic.AddInt32(&n, 1)
+    })
+  }
+  if err := e.Wait(); err != nil || n != 10 {
+    t.Errorf("test failed: %v %d", err, n)
+  }
+  // the executor can be reused after Wait
+  x := errors.New("failed")
+  e.Submit(func() error {
+    return x
+  })
+  if err := e.Wait(); !errors.Is(err, x) {
+    t.Errorf("test failed: %v", err)
+  }
+}
+
+func TestExecutorQueueFull(t *testing.T) {
+
+  p := New(2, 1, WorkersOnly(false))
+  defer p.Stop()
+
+  e := p.Executor()
+  release := make(chan struct{})
+  // block the worker and fill the queue
+  for i := 0; i < 3; i++ {
+    e.Execute(func() {
+      <-release
+    })
+  }
+  close(release)
+  // errors of submissions are returned by Wait
+  if err := e.Wait(); !errors.Is(err, ErrQueueFull) {
+    t.Errorf("test failed: %v", err)
+  }
+  if err := e.Wait(); err != nil {
+    t.Errorf("test failed: %v", err)
+  }
+}
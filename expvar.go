@@ -0,0 +1,75 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "expvar"
+import "sync/atomic"
+
+/* -------------------------------------------------------------------------- */
+
+type counter int
+
+const (
+  counterSubmitted counter = iota
+  counterCompleted
+  counterFailed
+  counterInline
+  numCounters
+)
+
+// Counters of submitted and executed jobs. Methods may be called on a
+// nil pointer, in which case nothing is counted
+type counters [numCounters]int64
+
+func (c *counters) add(k counter, n int) {
+  if c != nil {
+    atomic.AddInt64(&c[k], int64(n))
+  }
+}
+
+func (c *counters) get(k counter) int64 {
+  if c == nil {
+    return 0
+  }
+  return atomic.LoadInt64(&c[k])
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Enable counters and publish them as expvar variable [name]
+func (t *threadPool) publish(name string) {
+  t.counters = new(counters)
+  expvar.Publish(name, expvar.Func(func() interface{} {
+    queue := 0
+    if t.queue != nil {
+      queue = t.queue.length()
+    }
+    return map[string]int64{
+      "submitted": t.counters.get(counterSubmitted),
+      "completed": t.counters.get(counterCompleted),
+      "failed"   : t.counters.get(counterFailed),
+      "inline"   : t.counters.get(counterInline),
+      "queue"    : int64(queue) }
+  }))
+}
@@ -0,0 +1,56 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "encoding/json"
+import "expvar"
+import "fmt"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestExpvar(t *testing.T) {
+
+  // names must be unique, also if the test is repeated
+  name := fmt.Sprintf("threadpool_test_%d", time.Now().UnixNano())
+  p    := New(3, 100, Expvar(name))
+  g := p.NewJobGroup()
+
+  p.AddRangeJob(0, 10, g, func(i int, pool ThreadPool, erf func() error) error {
+    if i == 0 {
+      return fmt.Errorf("test error")
+    }
+    return nil
+  })
+  p.Wait(g)
+
+  r := map[string]int64{}
+  if err := json.Unmarshal([]byte(expvar.Get(name).String()), &r); err != nil {
+    t.Fatal(err)
+  }
+  if r["submitted"] != 4 || r["completed"] != 4 || r["failed"] != 1 || r["queue"] != 0 {
+    t.Errorf("test failed: %v", r)
+  }
+}
@@ -0,0 +1,201 @@
+//go:build go1.18
+// +build go1.18
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "context"
+import "strings"
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+// Result of a job that is computed asynchronously (requires Go 1.18)
+type Future[T any] struct {
+  once  sync.Once
+  done  chan struct{}
+  pool  ThreadPool
+  // state of the job group of the future, nil for pools with only
+  // one thread
+  group *jobGroupState
+  value T
+  err   error
+}
+
+// Submit [f] to [pool] and return a future of its result. The context
+// passed to [f] is cancelled by Cancel. Each future has its own job group,
+// which is released once the job is done
+func Async[T any](pool ThreadPool, f func(ctx context.Context, pool ThreadPool) (T, error)) *Future[T] {
+  r := Future[T]{done: make(chan struct{}), pool: pool}
+  if pool.NumberOfThreads() == 1 {
+    // the job is executed immediately
+    r.complete(pool.AddContextJob(0, func(ctx context.Context, pool ThreadPool) error {
+      v, err := f(ctx, pool)
+      r.value = v
+      return err
+    }))
+    return &r
+  }
+  jobGroup := pool.NewJobGroup()
+  r.group   = pool.getJobGroup(jobGroup)
+  ctx      := r.group.getContext()
+  err      := pool.addJob(jobGroup, job{f: func(pool ThreadPool, erf func() error) error {
+    v, err := f(ctx, pool)
+    r.value = v
+    return err
+  }, finish: func() {
+    // called once the job is done or dropped, after its error
+    // was recorded
+    r.complete(r.group.getError())
+    pool.clear(jobGroup)
+  }})
+  if err != nil {
+    r.complete(err)
+    pool.clear(jobGroup)
+  }
+  return &r
+}
+
+func (f *Future[T]) complete(err error) {
+  f.once.Do(func() {
+    f.err = err
+    close(f.done)
+  })
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Returns a channel that is closed once the result is available
+func (f *Future[T]) Done() <-chan struct{} {
+  return f.done
+}
+
+// Wait for the result of the job. Errors of the job are wrapped in a
+// JobError as in Wait, a cancelled job returns ErrCancelled
+func (f *Future[T]) Wait() (T, error) {
+  <- f.done
+  return f.value, f.err
+}
+
+// Same as Wait, but returns the error of [ctx] if it is done before the
+// result is available. The job is not cancelled, which can be requested
+// with Cancel
+func (f *Future[T]) Get(ctx context.Context) (T, error) {
+  select {
+  case <- f.done:
+    return f.value, f.err
+  case <- ctx.Done():
+    var r T
+    return r, ctx.Err()
+  }
+}
+
+// Cancel the job. A queued job is removed, whereas a running job only
+// observes the cancellation through its context
+func (f *Future[T]) Cancel() {
+  if f.group != nil {
+    f.pool.cancelGroup(f.group)
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Errors of several futures
+type JoinedError []error
+
+func (err JoinedError) Error() string {
+  s := make([]string, len(err))
+  for i, e := range err {
+    s[i] = e.Error()
+  }
+  return strings.Join(s, "; ")
+}
+
+// Allows errors.Is and errors.As to test all errors (requires Go 1.20)
+func (err JoinedError) Unwrap() []error {
+  return err
+}
+
+// Wait for all futures and return their results in the order of [fs].
+// Errors of all failed futures are returned as JoinedError
+func WaitAll[T any](fs ...*Future[T]) ([]T, error) {
+  r    := make([]T, len(fs))
+  errs := JoinedError{}
+  for i, f := range fs {
+    v, err := f.Wait()
+    if err != nil {
+      errs = append(errs, err)
+    }
+    r[i] = v
+  }
+  if len(errs) > 0 {
+    return r, errs
+  }
+  return r, nil
+}
+
+// Returns the result of the first future that succeeds. If all futures
+// fail, their errors are returned as JoinedError in the order of [fs]
+func WaitAny[T any](fs ...*Future[T]) (T, error) {
+  c    := completions(fs)
+  errs := make(JoinedError, len(fs))
+  for range fs {
+    i := <- c
+    if fs[i].err == nil {
+      return fs[i].value, nil
+    }
+    errs[i] = fs[i].err
+  }
+  var r T
+  return r, errs
+}
+
+// Returns the result of the first future that completes, either
+// successfully or not, and cancels all other futures
+func Race[T any](fs ...*Future[T]) (T, error) {
+  i := <- completions(fs)
+  for j, f := range fs {
+    if j != i {
+      f.Cancel()
+    }
+  }
+  return fs[i].value, fs[i].err
+}
+
+// Returns a channel that receives the index of each future in [fs] once
+// it completes
+func completions[T any](fs []*Future[T]) <-chan int {
+  if len(fs) == 0 {
+    panic("no futures")
+  }
+  c := make(chan int, len(fs))
+  for i, f := range fs {
+    go func(i int, f *Future[T]) {
+      <- f.done
+      c <- i
+    }(i, f)
+  }
+  return c
+}
@@ -0,0 +1,120 @@
+//go:build go1.18
+// +build go1.18
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "context"
+import "errors"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestFuture(t *testing.T) {
+
+  for _, n := range []int{1, 3} {
+    p := New(n, 100)
+    f := Async(p, func(ctx context.Context, pool ThreadPool) (int, error) {
+      return 42, nil
+    })
+    if v, err := f.Wait(); v != 42 || err != nil {
+      t.Errorf("test failed: %v %v", v, err)
+    }
+    e := errors.New("failed")
+    f  = Async(p, func(ctx context.Context, pool ThreadPool) (int, error) {
+      return 0, e
+    })
+    if _, err := f.Wait(); !errors.Is(err, e) {
+      t.Errorf("test failed: %v", err)
+    }
+    // state of the job groups is released
+    if n := len(p.Snapshot().Groups); n != 0 {
+      t.Errorf("test failed: %d", n)
+    }
+    p.Stop()
+  }
+}
+
+func TestFutureCombinators(t *testing.T) {
+
+  p := New(4, 100)
+  defer p.Stop()
+
+  e := errors.New("failed")
+  sleep := func(d time.Duration, v int, err error) *Future[int] {
+    return Async(p, func(ctx context.Context, pool ThreadPool) (int, error) {
+      select {
+      case <- time.After(d):
+        return v, err
+      case <- ctx.Done():
+        return 0, ctx.Err()
+      }
+    })
+  }
+  r, err := WaitAll(sleep(5*time.Millisecond, 1, nil), sleep(time.Millisecond, 2, e), sleep(0, 3, e))
+  if len(r) != 3 || r[0] != 1 {
+    t.Errorf("test failed: %v", r)
+  }
+  if errs, ok := err.(JoinedError); !ok || len(errs) != 2 || !errors.Is(errs[0], e) {
+    t.Errorf("test failed: %v", err)
+  }
+  if v, err := WaitAny(sleep(0, 1, e), sleep(5*time.Millisecond, 2, nil)); v != 2 || err != nil {
+    t.Errorf("test failed: %v %v", v, err)
+  }
+  if _, err := WaitAny(sleep(0, 1, e), sleep(0, 2, e)); err == nil {
+    t.Error("test failed")
+  }
+  // the slow future is cancelled
+  slow := sleep(time.Hour, 1, nil)
+  if v, err := Race(sleep(time.Millisecond, 2, nil), slow); v != 2 || err != nil {
+    t.Errorf("test failed: %v %v", v, err)
+  }
+  if _, err := slow.Wait(); !errors.Is(err, ErrCancelled) && !errors.Is(err, context.Canceled) {
+    t.Errorf("test failed: %v", err)
+  }
+}
+
+func TestFutureGet(t *testing.T) {
+
+  p := New(3, 100)
+  defer p.Stop()
+
+  release := make(chan struct{})
+  f := Async(p, func(ctx context.Context, pool ThreadPool) (int, error) {
+    <- release
+    return 42, nil
+  })
+  ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+  defer cancel()
+  if _, err := f.Get(ctx); err != context.DeadlineExceeded {
+    t.Errorf("test failed: %v", err)
+  }
+  // the job is not cancelled
+  close(release)
+  if v, err := f.Get(context.Background()); v != 42 || err != nil {
+    t.Errorf("test failed: %v %v", v, err)
+  }
+}
@@ -0,0 +1,140 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+// Handle of a pool that submits all jobs to a fixed job group, so that
+// functions can add jobs to the group of their caller without receiving
+// the group as argument. All other methods are the same as for the pool
+type GroupPool struct {
+  ThreadPool
+  jobGroup int
+}
+
+// Returns a handle that submits jobs to [jobGroup]
+func (t ThreadPool) WithGroup(jobGroup int) GroupPool {
+  return GroupPool{ThreadPool: t, jobGroup: jobGroup}
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Returns the job group of this handle
+func (t GroupPool) JobGroup() int {
+  return t.jobGroup
+}
+
+func (t GroupPool) AddJob(f func(pool ThreadPool, erf func() error) error) error {
+  return t.ThreadPool.AddJob(t.jobGroup, f)
+}
+
+func (t GroupPool) AddFunc(f func() error) error {
+  return t.ThreadPool.AddFunc(t.jobGroup, f)
+}
+
+func (t GroupPool) AddRangeJob(iFrom, iTo int, f func(i int, pool ThreadPool, erf func() error) error) error {
+  return t.ThreadPool.AddRangeJob(iFrom, iTo, t.jobGroup, f)
+}
+
+func (t GroupPool) AddRangeJob_(iFrom, iTo int, f func(ifrom, ito int, pool ThreadPool, erf func() error) error) error {
+  return t.ThreadPool.AddRangeJob_(iFrom, iTo, t.jobGroup, f)
+}
+
+// Wait until all jobs of the job group are done
+func (t GroupPool) Wait() error {
+  return t.ThreadPool.Wait(t.jobGroup)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Job group of a pool with chainable methods, i.e.
+//
+//   err := pool.NewGroup().Go(f).Go(g).GoRange(0, n, h).Wait()
+//
+// Errors of submissions are recorded and returned by Wait, further jobs
+// are not submitted once a submission failed
+type Group struct {
+  pool     ThreadPool
+  jobGroup int
+  err      error
+}
+
+// Returns a new job group (see NewJobGroup)
+func (t ThreadPool) NewGroup() *Group {
+  return &Group{pool: t, jobGroup: t.NewJobGroup()}
+}
+
+// Returns the job group
+func (g *Group) JobGroup() int {
+  return g.jobGroup
+}
+
+// Submit a single job (see AddJob)
+func (g *Group) Go(f func(pool ThreadPool, erf func() error) error) *Group {
+  if g.err == nil {
+    g.err = g.pool.AddJob(g.jobGroup, f)
+  }
+  return g
+}
+
+// Submit a range job (see AddRangeJob)
+func (g *Group) GoRange(iFrom, iTo int, f func(i int, pool ThreadPool, erf func() error) error) *Group {
+  if g.err == nil {
+    g.err = g.pool.AddRangeJob(iFrom, iTo, g.jobGroup, f)
+  }
+  return g
+}
+
+// Wait until all jobs are done and return the first error of a submission
+// or the error of the job group
+func (g *Group) Wait() error {
+  err := g.pool.Wait(g.jobGroup)
+  if g.err != nil {
+    return g.err
+  }
+  return err
+}
+
+/* default job group
+ * -------------------------------------------------------------------------- */
+
+// Returns the default job group of the pool, which is obtained from
+// NewJobGroup on first use
+func (t *threadPool) DefaultGroup() int {
+  if t == nil {
+    return 0
+  }
+  t.defaultOnce.Do(func() {
+    t.defaultGroup = t.NewJobGroup()
+  })
+  return t.defaultGroup
+}
+
+// Submit a single job to the default job group (see DefaultGroup)
+func (t ThreadPool) AddJobDefault(f func(pool ThreadPool, erf func() error) error) error {
+  return t.AddJob(t.DefaultGroup(), f)
+}
+
+// Wait until all jobs of the default job group are done
+func (t ThreadPool) WaitDefault() error {
+  return t.Wait(t.DefaultGroup())
+}
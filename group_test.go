@@ -0,0 +1,107 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync/atomic"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestWithGroup(t *testing.T) {
+
+  p := New(3, 100)
+  defer p.Stop()
+
+  n := int32(0)
+  // submits jobs without knowing the group
+  add := func(pool GroupPool) {
+    pool.AddRangeJob(0, 10, func(i int, pool ThreadPool, erf func() error) error {
+      atomic.AddInt32(&n, 1)
+      return nil
+    })
+    pool.AddFunc(func() error {
+      atomic.AddInt32(&n, 1)
+      return nil
+    })
+  }
+  g := p.WithGroup(p.NewJobGroup())
+  add(g)
+  if err := g.Wait(); err != nil {
+    t.Error(err)
+  }
+  if n != 11 {
+    t.Errorf("test failed: %d", n)
+  }
+}
+
+func TestDefaultGroup(t *testing.T) {
+
+  for _, n := range []int{1, 3} {
+    p := New(n, 100)
+    r := make([]int32, 10)
+    for k := 0; k < 2; k++ {
+      for i := range r {
+        i := i
+        p.AddJobDefault(func(pool ThreadPool, erf func() error) error {
+          atomic.AddInt32(&r[i], 1)
+          return nil
+        })
+      }
+      if err := p.WaitDefault(); err != nil {
+        t.Error(err)
+      }
+    }
+    for i := range r {
+      if r[i] != 2 {
+        t.Errorf("test failed: %v", r)
+      }
+    }
+    p.Stop()
+  }
+}
+
+func TestGroup(t *testing.T) {
+
+  for _, n := range []int{1, 3} {
+    p := New(n, 100)
+    r := make([]int32, 12)
+    f := func(i int) func(pool ThreadPool, erf func() error) error {
+      return func(pool ThreadPool, erf func() error) error {
+        atomic.AddInt32(&r[i], 1)
+        return nil
+      }
+    }
+    if err := p.NewGroup().Go(f(0)).Go(f(1)).GoRange(2, len(r), func(i int, pool ThreadPool, erf func() error) error {
+      return f(i)(pool, erf)
+    }).Wait(); err != nil {
+      t.Error(err)
+    }
+    for i := range r {
+      if r[i] != 1 {
+        t.Errorf("test failed: %v", r)
+      }
+    }
+    p.Stop()
+  }
+}
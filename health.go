@@ -0,0 +1,73 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "fmt"
+import "strings"
+import "sync/atomic"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Check the health of the pool. An error describing all problems is
+// returned if workers are missing, if the queue is full for longer than the
+// saturation threshold, or if a job group has pending jobs for longer than
+// the waiting threshold (see HealthThresholds)
+func (t ThreadPool) Check() error {
+  if t.threadPool == nil {
+    return nil
+  }
+  problems := []string{}
+  now      := time.Now()
+  if t.queue == nil || t.queue.isClosed() {
+    problems = append(problems, "pool is stopped")
+  } else if t.hasWorkers() {
+    // hibernating workers are not missing
+    if n := int(atomic.LoadInt32(&t.alive) + atomic.LoadInt32(&t.sleepers)); n < t.threads-1 {
+      problems = append(problems, fmt.Sprintf("%d of %d workers are running", n, t.threads-1))
+    }
+  }
+  if since := atomic.LoadInt64(&t.fullSince); since != 0 && t.saturation > 0 {
+    if d := now.Sub(time.Unix(0, since)); d > t.saturation {
+      problems = append(problems, fmt.Sprintf("queue is full for %v", d))
+    }
+  }
+  if t.waiting > 0 {
+    for _, g := range t.Snapshot().Groups {
+      if d := now.Sub(g.Created); g.Pending > 0 && d > t.waiting {
+        problems = append(problems, fmt.Sprintf("job group %d has %d pending jobs for %v", g.JobGroup, g.Pending, d))
+      }
+    }
+  }
+  if len(problems) == 0 {
+    return nil
+  }
+  return errors.New("threadpool: " + strings.Join(problems, "; "))
+}
+
+// Returns true if Check reports no problems
+func (t ThreadPool) Healthy() bool {
+  return t.Check() == nil
+}
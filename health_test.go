@@ -0,0 +1,79 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestHealth(t *testing.T) {
+
+  p := New(3, 1, HealthThresholds(time.Millisecond, time.Millisecond))
+  g := p.NewJobGroup()
+
+  time.Sleep(10*time.Millisecond)
+  if err := p.Check(); err != nil {
+    t.Error(err)
+  }
+  // saturate the queue, the last job is executed by the
+  // submitting thread
+  release   := make(chan struct{})
+  submitted := make(chan struct{})
+  go func() {
+    for i := 0; i < 4; i++ {
+      p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+        <- release
+        return nil
+      })
+    }
+    close(submitted)
+  }()
+  time.Sleep(10*time.Millisecond)
+  if p.Healthy() {
+    t.Error("test failed")
+  }
+  close(release)
+  <- submitted
+  p.Wait(g)
+  p.Stop()
+  if err := p.Check(); err == nil || err.Error() != "threadpool: pool is stopped" {
+    t.Errorf("test failed: %v", err)
+  }
+  if !Nil().Healthy() {
+    t.Error("test failed")
+  }
+}
+
+func TestHealthAfterNew(t *testing.T) {
+
+  // workers are running as soon as New returns
+  for i := 0; i < 100; i++ {
+    p := New(8, 10)
+    if err := p.Check(); err != nil {
+      t.Error(err)
+    }
+    p.Stop()
+  }
+}
@@ -0,0 +1,115 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync/atomic"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Release idle workers once the pool was idle for the hibernation period.
+// The goroutine exits when all workers are hibernating and is started
+// again by wake
+func (t *threadPool) hibernation(q jobQueue) {
+  interval := t.hibernate/4
+  if interval < time.Millisecond {
+    interval = time.Millisecond
+  }
+  ticker := time.NewTicker(interval)
+  defer ticker.Stop()
+  idleSince := time.Time{}
+  for now := range ticker.C {
+    if q.isClosed() {
+      return
+    }
+    if !t.idle(q) {
+      idleSince = time.Time{}
+      continue
+    }
+    if idleSince.IsZero() {
+      idleSince = now
+    }
+    if now.Sub(idleSince) < t.hibernate {
+      continue
+    }
+    if int(atomic.LoadInt32(&t.sleepers)) < t.threads-1 {
+      q.release()
+      continue
+    }
+    // all workers are hibernating, continue only if workers were
+    // started in the meantime and wake did not start another
+    // goroutine
+    atomic.StoreInt32(&t.watching, 0)
+    if int(atomic.LoadInt32(&t.sleepers)) == t.threads-1 || !atomic.CompareAndSwapInt32(&t.watching, 0, 1) {
+      return
+    }
+  }
+}
+
+// True if no jobs are queued or executed
+func (t *threadPool) idle(q jobQueue) bool {
+  if q.length() > 0 {
+    return false
+  }
+  for i := range t.activity {
+    if _, _, ok := t.activity[i].get(); ok {
+      return false
+    }
+  }
+  return true
+}
+
+// Called by worker [i] after it was released from the queue. Returns
+// false if jobs were queued in the meantime, in which case the worker
+// continues
+func (t *threadPool) sleep(q jobQueue, i int) bool {
+  atomic.StoreInt32(&t.sleeping[i], 1)
+  atomic.AddInt32(&t.sleepers, 1)
+  if q.length() == 0 {
+    return true
+  }
+  // the worker might have been restarted by wake already
+  if atomic.CompareAndSwapInt32(&t.sleeping[i], 1, 0) {
+    atomic.AddInt32(&t.sleepers, -1)
+    return false
+  }
+  return true
+}
+
+// Restart hibernating workers, called after jobs were queued
+func (t *threadPool) wake() {
+  if atomic.LoadInt32(&t.sleepers) == 0 {
+    return
+  }
+  q := t.queue
+  for i := 1; i < t.threads; i++ {
+    if atomic.CompareAndSwapInt32(&t.sleeping[i], 1, 0) {
+      atomic.AddInt32(&t.sleepers, -1)
+      t.spawn(q, i)
+    }
+  }
+  if atomic.CompareAndSwapInt32(&t.watching, 0, 1) {
+    go t.hibernation(q)
+  }
+}
@@ -0,0 +1,72 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync/atomic"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Wait until all workers are hibernating
+func waitForHibernation(p ThreadPool) bool {
+  for i := 0; i < 1000; i++ {
+    if atomic.LoadInt32(&p.sleepers) == 3 && atomic.LoadInt32(&p.alive) == 0 {
+      return true
+    }
+    time.Sleep(time.Millisecond)
+  }
+  return false
+}
+
+func TestHibernate(t *testing.T) {
+
+  for _, p := range []ThreadPool{
+    New(4, 100, Hibernate(10*time.Millisecond)),
+    New(4, 100, Hibernate(10*time.Millisecond), LockFreeQueue()) } {
+
+    if !waitForHibernation(p) {
+      t.Fatal("workers did not hibernate")
+    }
+    if !p.Healthy() {
+      t.Error(p.Check())
+    }
+    // workers are started again on submission
+    r := make([]int32, 4)
+    if err := p.RangeJob(0, 100, func(i int, pool ThreadPool, erf func() error) error {
+      time.Sleep(100*time.Microsecond)
+      atomic.AddInt32(&r[pool.GetThreadId()], 1)
+      return nil
+    }); err != nil {
+      t.Error(err)
+    }
+    if r[1] + r[2] + r[3] == 0 {
+      t.Errorf("test failed: %v", r)
+    }
+    if !waitForHibernation(p) {
+      t.Fatal("workers did not hibernate")
+    }
+    p.Stop()
+  }
+}
@@ -0,0 +1,109 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync/atomic"
+
+/* -------------------------------------------------------------------------- */
+
+// Returns a new job group that is a child of [parent]. Cancelling
+// [parent] with CancelJobGroup also cancels all of its descendants, as
+// does an error of a job of [parent] with the CancelChildren option. The
+// relation is kept until the state of either group is released
+func (t *threadPool) NewChildJobGroup(parent int) int {
+  if t == nil {
+    return 0
+  }
+  jobGroup := t.NewJobGroup()
+  p := t.getJobGroup(parent)
+  c := t.getJobGroup(jobGroup)
+  c.setParent(parent)
+  c.errmtx.Lock()
+  c.up = p
+  c.errmtx.Unlock()
+  p.errmtx.Lock()
+  p.children = append(p.children, c)
+  p.errmtx.Unlock()
+  if atomic.LoadInt32(&p.cancelled) != 0 {
+    // parent was cancelled before the child was linked
+    t.cancelGroup(c)
+  }
+  return jobGroup
+}
+
+// Cancel [jobGroup] and all of its descendants. Queued jobs of the groups
+// are removed, further jobs are dropped and AddJob returns ErrCancelled.
+// Wait returns ErrCancelled unless a job of the group failed before
+func (t *threadPool) CancelJobGroup(jobGroup int) {
+  if t == nil {
+    return
+  }
+  t.cancelGroup(t.getJobGroup(jobGroup))
+}
+
+/* -------------------------------------------------------------------------- */
+
+func (t *threadPool) cancelGroup(group *jobGroupState) {
+  if !atomic.CompareAndSwapInt32(&group.cancelled, 0, 1) {
+    return
+  }
+  if group.getError() == nil {
+    group.setError(ErrCancelled)
+  }
+  t.cancel(group)
+  t.cancelDescendants(group)
+}
+
+func (t *threadPool) cancelDescendants(group *jobGroupState) {
+  group.errmtx.RLock()
+  children := append([]*jobGroupState{}, group.children...)
+  group.errmtx.RUnlock()
+  for _, child := range children {
+    t.cancelGroup(child)
+  }
+}
+
+// True if jobs of [group] are dropped
+func (t *threadPool) dropped(group *jobGroupState) bool {
+  return atomic.LoadInt32(&group.cancelled) != 0 || t.cancelOnError && group.getError() != nil
+}
+
+// Remove the group from the children of its parent
+func (obj *jobGroupState) unlink() {
+  obj.errmtx.Lock()
+  p := obj.up
+  obj.up = nil
+  obj.errmtx.Unlock()
+  if p == nil {
+    return
+  }
+  p.errmtx.Lock()
+  defer p.errmtx.Unlock()
+  for i, c := range p.children {
+    if c == obj {
+      p.children = append(p.children[:i], p.children[i+1:]...)
+      break
+    }
+  }
+}
@@ -0,0 +1,94 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "sync/atomic"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestCancelJobGroup(t *testing.T) {
+
+  p := New(2, 100, Manual())
+  g0 := p.NewJobGroup()
+  g1 := p.NewChildJobGroup(g0)
+  g2 := p.NewChildJobGroup(g1)
+  g3 := p.NewJobGroup()
+
+  n := int32(0)
+  for _, g := range []int{g0, g1, g2, g3} {
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      atomic.AddInt32(&n, 1)
+      return nil
+    })
+  }
+  p.CancelJobGroup(g1)
+
+  if err := p.AddJob(g2, func(pool ThreadPool, erf func() error) error {
+    return nil
+  }); err != ErrCancelled {
+    t.Errorf("test failed: %v", err)
+  }
+  for _, g := range []int{g1, g2} {
+    if err := p.Wait(g); !errors.Is(err, ErrCancelled) {
+      t.Errorf("test failed: %v", err)
+    }
+  }
+  for _, g := range []int{g0, g3} {
+    if err := p.Wait(g); err != nil {
+      t.Error(err)
+    }
+  }
+  if n != 2 {
+    t.Errorf("test failed: %d", n)
+  }
+}
+
+func TestCancelChildren(t *testing.T) {
+
+  p := New(3, 100, CancelChildren())
+  defer p.Stop()
+  g0 := p.NewJobGroup()
+  g1 := p.NewChildJobGroup(g0)
+
+  p.AddJob(g1, func(pool ThreadPool, erf func() error) error {
+    // wait until the parent failed
+    for erf() == nil {
+      time.Sleep(time.Millisecond)
+    }
+    return nil
+  })
+  p.AddJob(g0, func(pool ThreadPool, erf func() error) error {
+    time.Sleep(time.Millisecond)
+    return errors.New("failed")
+  })
+  if err := p.Wait(g1); !errors.Is(err, ErrCancelled) {
+    t.Errorf("test failed: %v", err)
+  }
+  if err := p.Wait(g0); err == nil || errors.Is(err, ErrCancelled) {
+    t.Errorf("test failed: %v", err)
+  }
+}
@@ -0,0 +1,164 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "bufio"
+import "fmt"
+import "io"
+import "sort"
+import "sync"
+import "sync/atomic"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Histogram of job execution times
+type Histogram struct {
+  // upper bounds of the bins
+  Buckets []time.Duration `json:"buckets"`
+  // number of jobs in each bin, where the last bin counts jobs
+  // exceeding all bounds
+  Counts  []uint64        `json:"counts"`
+  Count   uint64          `json:"count"`
+  Sum     time.Duration   `json:"sum"`
+}
+
+type histogram struct {
+  buckets []time.Duration
+  counts  []uint64
+  count   uint64
+  sum     int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+  i := sort.Search(len(h.buckets), func(i int) bool { return d <= h.buckets[i] })
+  atomic.AddUint64(&h.counts[i], 1)
+  atomic.AddUint64(&h.count, 1)
+  atomic.AddInt64 (&h.sum, int64(d))
+}
+
+func (h *histogram) get() Histogram {
+  r := Histogram{Buckets: h.buckets, Counts: make([]uint64, len(h.counts))}
+  for i := range h.counts {
+    r.Counts[i] = atomic.LoadUint64(&h.counts[i])
+  }
+  r.Count = atomic.LoadUint64(&h.count)
+  r.Sum   = time.Duration(atomic.LoadInt64(&h.sum))
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Histograms of all job groups. In contrast to the state of job groups,
+// histograms are kept after Wait returns
+type histograms struct {
+  mtx     sync.Mutex
+  buckets []time.Duration
+  m       map[int]*histogram
+}
+
+func newHistograms(buckets []time.Duration) *histograms {
+  b := append([]time.Duration{}, buckets...)
+  sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+  return &histograms{buckets: b, m: make(map[int]*histogram)}
+}
+
+// Returns the histogram of [jobGroup], which is created if it does not
+// exist. Returns nil if histograms are disabled
+func (h *histograms) get(jobGroup int) *histogram {
+  if h == nil {
+    return nil
+  }
+  h.mtx.Lock()
+  defer h.mtx.Unlock()
+  r, ok := h.m[jobGroup]
+  if !ok {
+    r = &histogram{buckets: h.buckets, counts: make([]uint64, len(h.buckets)+1)}
+    h.m[jobGroup] = r
+  }
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+func (h *histogram) reset() {
+  for i := range h.counts {
+    atomic.StoreUint64(&h.counts[i], 0)
+  }
+  atomic.StoreUint64(&h.count, 0)
+  atomic.StoreInt64 (&h.sum, 0)
+}
+
+// Release the histograms of all job groups that were cleared. Histograms
+// of job groups that still exist are reset
+func (t *threadPool) ClearHistograms() {
+  if t == nil || t.histograms == nil {
+    return
+  }
+  // histograms are locked after the shards when groups are
+  // created, hence collect existing groups first
+  groups := map[int]struct{}{}
+  for i := range t.groups {
+    shard := &t.groups[i]
+    shard.mtx.RLock()
+    for jobGroup := range shard.m {
+      groups[jobGroup] = struct{}{}
+    }
+    shard.mtx.RUnlock()
+  }
+  t.histograms.mtx.Lock()
+  defer t.histograms.mtx.Unlock()
+  for jobGroup, h := range t.histograms.m {
+    if _, ok := groups[jobGroup]; ok {
+      h.reset()
+    } else {
+      delete(t.histograms.m, jobGroup)
+    }
+  }
+}
+
+// Write histograms of job execution times in the Prometheus text format
+// as metric [name], i.e. threadpool_job_duration_seconds
+func (t ThreadPool) WritePrometheus(w io.Writer, name string) error {
+  stats  := t.Stats()
+  groups := make([]int, 0, len(stats.Histograms))
+  for jobGroup := range stats.Histograms {
+    groups = append(groups, jobGroup)
+  }
+  sort.Ints(groups)
+  writer := bufio.NewWriter(w)
+  fmt.Fprintf(writer, "# TYPE %s histogram\n", name)
+  for _, jobGroup := range groups {
+    h := stats.Histograms[jobGroup]
+    n := uint64(0)
+    for i, b := range h.Buckets {
+      n += h.Counts[i]
+      fmt.Fprintf(writer, "%s_bucket{group=\"%d\",le=\"%g\"} %d\n", name, jobGroup, b.Seconds(), n)
+    }
+    fmt.Fprintf(writer, "%s_bucket{group=\"%d\",le=\"+Inf\"} %d\n", name, jobGroup, h.Count)
+    fmt.Fprintf(writer, "%s_sum{group=\"%d\"} %g\n", name, jobGroup, h.Sum.Seconds())
+    fmt.Fprintf(writer, "%s_count{group=\"%d\"} %d\n", name, jobGroup, h.Count)
+  }
+  return writer.Flush()
+}
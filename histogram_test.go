@@ -0,0 +1,61 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "bytes"
+import "fmt"
+import "strings"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestHistograms(t *testing.T) {
+
+  p := New(3, 100, Histograms(time.Second, time.Millisecond))
+  g := p.NewJobGroup()
+
+  p.AddRangeJob(0, 10, g, func(i int, pool ThreadPool, erf func() error) error {
+    if i == 0 {
+      time.Sleep(2*time.Millisecond)
+    }
+    return nil
+  })
+  p.Wait(g)
+
+  // histograms are kept after Wait
+  h, ok := p.Stats().Histograms[g]
+  if !ok || h.Count != 4 || len(h.Counts) != 3 || h.Counts[1] != 1 || h.Buckets[0] != time.Millisecond {
+    t.Errorf("test failed: %+v", h)
+  }
+  buf := bytes.Buffer{}
+  p.WritePrometheus(&buf, "threadpool_job_duration_seconds")
+  if s := buf.String(); !strings.Contains(s, fmt.Sprintf(`threadpool_job_duration_seconds_bucket{group="%d",le="+Inf"} 4`, g)) {
+    t.Errorf("test failed: %s", s)
+  }
+  p.ClearHistograms()
+  if len(p.Stats().Histograms) != 0 {
+    t.Error("test failed")
+  }
+}
@@ -0,0 +1,294 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package journal persists queued jobs of a thread pool on disk, so that
+// a long batch run can be resumed after a crash. Jobs are described by the
+// name of a handler and a serialized payload. Each job is recorded in an
+// append-only journal when it is submitted and marked as done once it has
+// been executed. Jobs that were not done when the process terminated are
+// submitted again by Resume, i.e. jobs are executed at least once. Jobs
+// are synced to disk before they are submitted, such that they also survive
+// a crash of the operating system.
+package journal
+
+/* -------------------------------------------------------------------------- */
+
+import "bufio"
+import "encoding/binary"
+import "fmt"
+import "io"
+import "os"
+import "path/filepath"
+import "sort"
+import "sync"
+
+import "github.com/pbenner/threadpool"
+
+/* -------------------------------------------------------------------------- */
+
+// Executes a journaled job
+type Handler func(payload []byte, pool threadpool.ThreadPool, erf func() error) error
+
+type record struct {
+  name    string
+  payload []byte
+}
+
+const (
+  recordAdd  = byte('A')
+  recordDone = byte('D')
+)
+
+/* -------------------------------------------------------------------------- */
+
+type Journal struct {
+  pool     threadpool.ThreadPool
+  handlers map[string]Handler
+  mtx      sync.Mutex
+  file     *os.File
+  next     uint64
+  // jobs of a previous run that were not done
+  pending  map[uint64]record
+}
+
+// Open the journal at [path], which is created if it does not exist. Jobs
+// of a previous run that were not done are kept and can be submitted again
+// with Resume. The journal is compacted, such that it only contains these
+// jobs
+func Open(pool threadpool.ThreadPool, path string, handlers map[string]Handler) (*Journal, error) {
+  pending, err := readJournal(path)
+  if err != nil {
+    return nil, err
+  }
+  j := Journal{pool: pool, handlers: handlers, pending: pending}
+  // rewrite journal with all pending jobs
+  tmp := path + ".tmp"
+  if j.file, err = os.Create(tmp); err != nil {
+    return nil, err
+  }
+  for _, id := range j.pendingIds() {
+    if err := j.write(recordAdd, id, pending[id]); err != nil {
+      j.file.Close()
+      return nil, err
+    }
+    if id > j.next {
+      j.next = id
+    }
+  }
+  if err := j.file.Sync(); err != nil {
+    j.file.Close()
+    return nil, err
+  }
+  if err := os.Rename(tmp, path); err != nil {
+    j.file.Close()
+    return nil, err
+  }
+  syncDir(filepath.Dir(path))
+  return &j, nil
+}
+
+// Close the journal. Jobs that are still running when the journal is
+// closed are submitted again by the next Resume
+func (j *Journal) Close() error {
+  j.mtx.Lock()
+  defer j.mtx.Unlock()
+  if j.file == nil {
+    return nil
+  }
+  err := j.file.Close()
+  j.file = nil
+  return err
+}
+
+// Record a job in the journal and submit it to [jobGroup] of the pool
+func (j *Journal) AddJob(jobGroup int, name string, payload []byte) error {
+  if _, ok := j.handlers[name]; !ok {
+    return fmt.Errorf("journal: no handler for job `%s'", name)
+  }
+  j.mtx.Lock()
+  j.next += 1
+  id := j.next
+  err := j.write(recordAdd, id, record{name, payload})
+  if err == nil {
+    err = j.file.Sync()
+  }
+  j.mtx.Unlock()
+  if err != nil {
+    return err
+  }
+  return j.submit(jobGroup, id, record{name, payload})
+}
+
+// Submit all jobs of a previous run that were not done to [jobGroup]
+// and return their number
+func (j *Journal) Resume(jobGroup int) (int, error) {
+  j.mtx.Lock()
+  ids     := j.pendingIds()
+  pending := j.pending
+  j.pending = nil
+  j.mtx.Unlock()
+  for i, id := range ids {
+    if err := j.submit(jobGroup, id, pending[id]); err != nil {
+      return i, err
+    }
+  }
+  return len(ids), nil
+}
+
+func (j *Journal) submit(jobGroup int, id uint64, r record) error {
+  h, ok := j.handlers[r.name]
+  if !ok {
+    return fmt.Errorf("journal: no handler for job `%s'", r.name)
+  }
+  return j.pool.AddJob(jobGroup, func(pool threadpool.ThreadPool, erf func() error) error {
+    err := h(r.payload, pool, erf)
+    // jobs that failed are also done, since their error is
+    // reported by Wait
+    j.mtx.Lock()
+    defer j.mtx.Unlock()
+    if j.file == nil {
+      // journal was closed while the job was running, the job
+      // is submitted again by the next Resume
+      return err
+    }
+    if e := j.write(recordDone, id, record{}); e != nil && err == nil {
+      err = e
+    }
+    return err
+  })
+}
+
+func (j *Journal) pendingIds() []uint64 {
+  ids := make([]uint64, 0, len(j.pending))
+  for id := range j.pending {
+    ids = append(ids, id)
+  }
+  sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+  return ids
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Records are encoded as type, id, length of name, name, length of
+// payload and payload
+func (j *Journal) write(t byte, id uint64, r record) error {
+  if j.file == nil {
+    return fmt.Errorf("journal: journal is closed")
+  }
+  buf := make([]byte, 0, 17+len(r.name)+len(r.payload))
+  buf  = append(buf, t)
+  buf  = appendUint64(buf, id)
+  buf  = appendUint32(buf, uint32(len(r.name)))
+  buf  = append(buf, r.name...)
+  buf  = appendUint32(buf, uint32(len(r.payload)))
+  buf  = append(buf, r.payload...)
+  _, err := j.file.Write(buf)
+  return err
+}
+
+// Sync the directory [dir], so that a renamed journal survives a crash
+// of the operating system. Directories cannot be synced on all platforms,
+// in which case errors are ignored
+func syncDir(dir string) {
+  if f, err := os.Open(dir); err == nil {
+    f.Sync()
+    f.Close()
+  }
+}
+
+func appendUint64(buf []byte, x uint64) []byte {
+  var tmp [8]byte
+  binary.LittleEndian.PutUint64(tmp[:], x)
+  return append(buf, tmp[:]...)
+}
+
+func appendUint32(buf []byte, x uint32) []byte {
+  var tmp [4]byte
+  binary.LittleEndian.PutUint32(tmp[:], x)
+  return append(buf, tmp[:]...)
+}
+
+// Read journal and return all jobs that are not done. A truncated record
+// at the end of the journal, i.e. a record that was only partially written
+// before a crash, is ignored
+func readJournal(path string) (map[uint64]record, error) {
+  pending := make(map[uint64]record)
+  f, err := os.Open(path)
+  if os.IsNotExist(err) {
+    return pending, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+  info, err := f.Stat()
+  if err != nil {
+    return nil, err
+  }
+  // lengths of records are checked against the remaining size
+  // of the file, so that corrupt lengths are not allocated
+  reader := &io.LimitedReader{R: bufio.NewReader(f), N: info.Size()}
+  for {
+    t, id, r, err := readRecord(reader)
+    if err == io.EOF || err == io.ErrUnexpectedEOF {
+      return pending, nil
+    }
+    if err != nil {
+      return nil, err
+    }
+    switch t {
+    case recordAdd:
+      pending[id] = r
+    case recordDone:
+      delete(pending, id)
+    default:
+      return nil, fmt.Errorf("journal: invalid record type in `%s'", path)
+    }
+  }
+}
+
+func readRecord(reader *io.LimitedReader) (byte, uint64, record, error) {
+  var header [13]byte
+  if _, err := io.ReadFull(reader, header[:]); err != nil {
+    return 0, 0, record{}, err
+  }
+  id := binary.LittleEndian.Uint64(header[1:9])
+  m  := binary.LittleEndian.Uint32(header[9:13])
+  if int64(m) > reader.N {
+    return 0, 0, record{}, io.ErrUnexpectedEOF
+  }
+  name := make([]byte, m)
+  if _, err := io.ReadFull(reader, name); err != nil {
+    return 0, 0, record{}, io.ErrUnexpectedEOF
+  }
+  var n [4]byte
+  if _, err := io.ReadFull(reader, n[:]); err != nil {
+    return 0, 0, record{}, io.ErrUnexpectedEOF
+  }
+  if int64(binary.LittleEndian.Uint32(n[:])) > reader.N {
+    return 0, 0, record{}, io.ErrUnexpectedEOF
+  }
+  payload := make([]byte, binary.LittleEndian.Uint32(n[:]))
+  if _, err := io.ReadFull(reader, payload); err != nil {
+    return 0, 0, record{}, io.ErrUnexpectedEOF
+  }
+  return header[0], id, record{string(name), payload}, nil
+}
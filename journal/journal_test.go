@@ -0,0 +1,159 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package journal
+
+/* -------------------------------------------------------------------------- */
+
+import "io/ioutil"
+import "os"
+import "path/filepath"
+import "sync/atomic"
+import "testing"
+
+import "github.com/pbenner/threadpool"
+
+/* -------------------------------------------------------------------------- */
+
+func TestJournal(t *testing.T) {
+
+  dir, err := ioutil.TempDir("", "journal")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  path := filepath.Join(dir, "jobs")
+
+  n := int32(0)
+  handlers := map[string]Handler{
+    "count": func(payload []byte, pool threadpool.ThreadPool, erf func() error) error {
+      atomic.AddInt32(&n, int32(payload[0]))
+      return nil
+    },
+  }
+  // first run, jobs are journaled but never executed
+  p := threadpool.New(3, 100, threadpool.Manual())
+  j, err := Open(p, path, handlers)
+  if err != nil {
+    t.Fatal(err)
+  }
+  g := p.NewJobGroup()
+  for i := 1; i <= 4; i++ {
+    if err := j.AddJob(g, "count", []byte{byte(i)}); err != nil {
+      t.Error(err)
+    }
+  }
+  // execute only one job
+  p.Step()
+  j.Close()
+  // append a truncated record
+  f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+  f.Write([]byte{recordAdd, 1, 2})
+  f.Close()
+
+  // second run
+  p = threadpool.New(3, 100)
+  j, err = Open(p, path, handlers)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer j.Close()
+  g = p.NewJobGroup()
+  if r, err := j.Resume(g); err != nil || r != 3 {
+    t.Errorf("test failed: %d %v", r, err)
+  }
+  if err := j.AddJob(g, "unknown", nil); err == nil {
+    t.Error("test failed")
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  if n != 10 {
+    t.Errorf("test failed: %d", n)
+  }
+  if r, _ := j.Resume(g); r != 0 {
+    t.Error("test failed")
+  }
+}
+
+func TestJournalClosed(t *testing.T) {
+
+  dir, err := ioutil.TempDir("", "journal")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  path := filepath.Join(dir, "jobs")
+
+  handlers := map[string]Handler{
+    "nop": func(payload []byte, pool threadpool.ThreadPool, erf func() error) error {
+      return nil
+    },
+  }
+  p := threadpool.New(3, 100, threadpool.Manual())
+  j, err := Open(p, path, handlers)
+  if err != nil {
+    t.Fatal(err)
+  }
+  g := p.NewJobGroup()
+  if err := j.AddJob(g, "nop", nil); err != nil {
+    t.Error(err)
+  }
+  // jobs that are done after Close do not fail
+  j.Close()
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  j, err = Open(p, path, handlers)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer j.Close()
+  if r, err := j.Resume(g); err != nil || r != 1 {
+    t.Errorf("test failed: %d %v", r, err)
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestJournalCorrupt(t *testing.T) {
+
+  dir, err := ioutil.TempDir("", "journal")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  path := filepath.Join(dir, "jobs")
+
+  // record with a corrupt length of the name
+  if err := ioutil.WriteFile(path, []byte{recordAdd, 1, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}, 0644); err != nil {
+    t.Fatal(err)
+  }
+  j, err := Open(threadpool.New(3, 100), path, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer j.Close()
+  if r, err := j.Resume(0); err != nil || r != 0 {
+    t.Errorf("test failed: %d %v", r, err)
+  }
+}
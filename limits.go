@@ -0,0 +1,154 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+// Limits the number of jobs with the same key that are queued or executed
+// at the same time. Further jobs are kept back until a job with this key
+// is done
+type keyLimit struct {
+  mtx     sync.Mutex
+  limit   int
+  active  int
+  pending []pendingJob
+}
+
+type pendingJob struct {
+  // handle that submits the job once it is dispatched
+  pool ThreadPool
+  job  job
+}
+
+// Limits indexed by key
+type keyLimits struct {
+  mtx sync.Mutex
+  m   map[string]*keyLimit
+}
+
+func (obj *keyLimits) get(key string) *keyLimit {
+  obj.mtx.Lock()
+  defer obj.mtx.Unlock()
+  return obj.m[key]
+}
+
+func (obj *keyLimits) set(key string, n int) {
+  obj.mtx.Lock()
+  defer obj.mtx.Unlock()
+  if n <= 0 {
+    delete(obj.m, key)
+    return
+  }
+  if l, ok := obj.m[key]; ok {
+    l.mtx.Lock()
+    l.limit = n
+    l.mtx.Unlock()
+    // dispatch jobs that are no longer kept back
+    for l.dispatch() {
+    }
+    return
+  }
+  if obj.m == nil {
+    obj.m = make(map[string]*keyLimit)
+  }
+  obj.m[key] = &keyLimit{limit: n}
+}
+
+/* -------------------------------------------------------------------------- */
+
+func (l *keyLimit) submit(pool ThreadPool, j job) error {
+  finish := j.finish
+  j.finish = func() {
+    l.next()
+    if finish != nil {
+      finish()
+    }
+  }
+  l.mtx.Lock()
+  if l.active >= l.limit {
+    // the handle must not be reserved, since the job is
+    // dispatched by another thread
+    l.pending = append(l.pending, pendingJob{ThreadPool{threadPool: pool.threadPool, sub: pool.sub}, j})
+    l.mtx.Unlock()
+    return nil
+  }
+  l.active += 1
+  l.mtx.Unlock()
+  return pool.submit(j)
+}
+
+// Called when a job with this key is done, dispatches the next
+// pending job
+func (l *keyLimit) next() {
+  l.mtx.Lock()
+  l.active -= 1
+  l.mtx.Unlock()
+  l.dispatch()
+}
+
+// Submit the next pending job if the limit allows it. Returns false if
+// no job was submitted
+func (l *keyLimit) dispatch() bool {
+  l.mtx.Lock()
+  if len(l.pending) == 0 || l.active >= l.limit {
+    l.mtx.Unlock()
+    return false
+  }
+  p := l.pending[0]
+  l.pending[0] = pendingJob{}
+  l.pending    = l.pending[1:]
+  l.active += 1
+  l.mtx.Unlock()
+  // if the job cannot be submitted, it is finished
+  // immediately, which dispatches the next job
+  p.pool.submit(p.job)
+  return true
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Limit the number of jobs submitted with AddLimitedJob and [key] that are
+// queued or executed at the same time to [n], independent of the number
+// of threads. A limit of zero or less removes the limit of [key]. Jobs
+// must not wait for jobs with the same key, since these might be kept
+// back
+func (t ThreadPool) SetKeyLimit(key string, n int) {
+  if t.threadPool == nil {
+    return
+  }
+  t.limits.set(key, n)
+}
+
+// Submit a single job that is subject to the limit of [key] (see
+// SetKeyLimit). If the limit is reached, the job is kept back until
+// another job with this key is done. Jobs with keys without limit are
+// submitted as by AddJob
+func (t ThreadPool) AddLimitedJob(jobGroup int, key string, f func(pool ThreadPool, erf func() error) error) error {
+  if t.NumberOfThreads() == 1 {
+    return t.AddJob(jobGroup, f)
+  }
+  return t.addJob(jobGroup, job{f: f, limit: t.limits.get(key)})
+}
@@ -0,0 +1,63 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync/atomic"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestKeyLimit(t *testing.T) {
+
+  p := New(5, 100)
+  g := p.NewJobGroup()
+  p.SetKeyLimit("a", 2)
+
+  running := map[string]*int32{"a": new(int32), "b": new(int32)}
+  max     := map[string]*int32{"a": new(int32), "b": new(int32)}
+  for i := 0; i < 40; i++ {
+    key := "a"
+    if i % 2 == 1 {
+      key = "b"
+    }
+    p.AddLimitedJob(g, key, func(pool ThreadPool, erf func() error) error {
+      n := atomic.AddInt32(running[key], 1)
+      defer atomic.AddInt32(running[key], -1)
+      for m := atomic.LoadInt32(max[key]); n > m; m = atomic.LoadInt32(max[key]) {
+        atomic.CompareAndSwapInt32(max[key], m, n)
+      }
+      time.Sleep(time.Millisecond)
+      return nil
+    })
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  // jobs without limit are executed by all threads
+  if *max["a"] != 2 || *max["b"] <= 2 {
+    t.Errorf("test failed: %d %d", *max["a"], *max["b"])
+  }
+  p.Stop()
+}
@@ -0,0 +1,137 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "bufio"
+import "io"
+
+/* -------------------------------------------------------------------------- */
+
+// Maximum number of lines and bytes of a batch
+const (
+  linesPerBatch = 1024
+  bytesPerBatch = 1 << 16
+)
+
+// Lines that are processed by a single job
+type lineBatch struct {
+  // number of the first line
+  first int
+  data  []byte
+  // ranges of the lines in data without line endings
+  lines [][2]int
+}
+
+// Read the next lines from [r] into the batch. Returns io.EOF at the end
+// of the input
+func (b *lineBatch) read(r *bufio.Reader, first int) error {
+  b.first = first
+  b.data  = b.data[:0]
+  b.lines = b.lines[:0]
+  for len(b.lines) < linesPerBatch && len(b.data) < bytesPerBatch {
+    i := len(b.data)
+    var err error
+    for {
+      var s []byte
+      s, err  = r.ReadSlice('\n')
+      b.data  = append(b.data, s...)
+      if err != bufio.ErrBufferFull {
+        break
+      }
+    }
+    j := len(b.data)
+    if j > i && b.data[j-1] == '\n' {
+      j--
+      if j > i && b.data[j-1] == '\r' {
+        j--
+      }
+      b.lines = append(b.lines, [2]int{i, j})
+    } else if j > i {
+      // last line without line ending
+      b.lines = append(b.lines, [2]int{i, j})
+    }
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Read [r] line by line and call [f] for each line in parallel, where lines
+// are numbered starting at one. Lines are read sequentially by the calling
+// thread and dispatched in batches to the pool. At most two batches per
+// thread are buffered, hence reading is paused while the pool is busy. The
+// line is only valid until [f] returns. Line endings "\n" and "\r\n" are
+// removed. Reading stops as soon as [f] returns an error
+func Lines(pool ThreadPool, r io.Reader, f func(lineNo int, line []byte) error) error {
+  g    := pool.NewJobGroup()
+  free := make(chan *lineBatch, 2*pool.NumberOfThreads())
+  for i := 0; i < cap(free); i++ {
+    free <- &lineBatch{}
+  }
+  reader := bufio.NewReader(r)
+  n      := 1
+  // errors of reading and of submitting batches
+  var err, serr error
+  for err == nil && serr == nil && pool.GroupError(g) == nil {
+    var b *lineBatch
+    for b == nil {
+      select {
+      case b = <- free:
+      default:
+        // help processing batches, which is required
+        // if the pool has no workers
+        if !pool.Step() {
+          b = <- free
+        }
+      }
+    }
+    err = b.read(reader, n)
+    n  += len(b.lines)
+    serr = pool.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      defer func() { free <- b }()
+      for i, line := range b.lines {
+        if erf() != nil {
+          return nil
+        }
+        if err := f(b.first+i, b.data[line[0]:line[1]]); err != nil {
+          return err
+        }
+      }
+      return nil
+    })
+  }
+  if err := pool.Wait(g); err != nil {
+    return err
+  }
+  if serr != nil {
+    return serr
+  }
+  if err != io.EOF {
+    return err
+  }
+  return nil
+}
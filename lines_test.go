@@ -0,0 +1,73 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "fmt"
+import "strconv"
+import "strings"
+import "sync/atomic"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestLines(t *testing.T) {
+
+  s := strings.Builder{}
+  for i := 1; i <= 5000; i++ {
+    if i % 2 == 0 {
+      fmt.Fprintf(&s, "%d\r\n", i)
+    } else {
+      fmt.Fprintf(&s, "%d\n", i)
+    }
+  }
+  // last line without line ending
+  s.WriteString("5001")
+
+  for _, p := range []ThreadPool{New(4, 100), New(4, 2, Manual()), New(1, 1)} {
+    n := int64(0)
+    if err := Lines(p, strings.NewReader(s.String()), func(lineNo int, line []byte) error {
+      if string(line) != strconv.Itoa(lineNo) {
+        return fmt.Errorf("invalid line %d: %q", lineNo, line)
+      }
+      atomic.AddInt64(&n, 1)
+      return nil
+    }); err != nil {
+      t.Error(err)
+    }
+    if n != 5001 {
+      t.Errorf("test failed: %d", n)
+    }
+    e := errors.New("failed")
+    if err := Lines(p, strings.NewReader(s.String()), func(lineNo int, line []byte) error {
+      if lineNo == 100 {
+        return e
+      }
+      return nil
+    }); !errors.Is(err, e) {
+      t.Errorf("test failed: %v", err)
+    }
+    p.Stop()
+  }
+}
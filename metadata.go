@@ -0,0 +1,125 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+
+/* -------------------------------------------------------------------------- */
+
+// Key/value pairs attached to jobs or job groups, which allow to correlate
+// jobs with entities of the application
+type Metadata map[string]string
+
+// Error of a job with metadata
+type MetadataError struct {
+  Err      error
+  Metadata Metadata
+}
+
+func (obj *MetadataError) Error() string {
+  return obj.Err.Error()
+}
+
+func (obj *MetadataError) Unwrap() error {
+  return obj.Err
+}
+
+func wrapMetadata(err error, md Metadata) error {
+  if len(md) == 0 {
+    return err
+  }
+  return &MetadataError{Err: err, Metadata: md}
+}
+
+// Returns the metadata of the job that returned [err]
+func ErrorMetadata(err error) Metadata {
+  var e *MetadataError
+  if errors.As(err, &e) {
+    return e.Metadata
+  }
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Attach metadata to [jobGroup], which is inherited by all jobs of the
+// group. The metadata is released together with the state of the job
+// group
+func (t *threadPool) SetGroupMetadata(jobGroup int, md Metadata) {
+  if t == nil {
+    return
+  }
+  state := t.getJobGroup(jobGroup)
+  state.errmtx.Lock()
+  state.meta = md
+  state.errmtx.Unlock()
+}
+
+func (obj *jobGroupState) getMetadata() Metadata {
+  obj.errmtx.RLock()
+  defer obj.errmtx.RUnlock()
+  return obj.meta
+}
+
+// Set the name of [jobGroup], which is reported by errors of its jobs (see
+// JobError). The name is released together with the state of the job
+// group
+func (t *threadPool) SetGroupName(jobGroup int, name string) {
+  if t == nil {
+    return
+  }
+  state := t.getJobGroup(jobGroup)
+  state.errmtx.Lock()
+  state.name = name
+  state.errmtx.Unlock()
+}
+
+func (obj *jobGroupState) getName() string {
+  obj.errmtx.RLock()
+  defer obj.errmtx.RUnlock()
+  return obj.name
+}
+
+// Returns the metadata of the job executed with this handle, including the
+// metadata of its job group. Metadata of the job takes precedence
+func (t ThreadPool) Metadata() Metadata {
+  var md Metadata
+  if t.metaGroup != nil {
+    md = t.metaGroup.getMetadata()
+  }
+  if len(t.meta) == 0 {
+    return md
+  }
+  if len(md) == 0 {
+    return t.meta
+  }
+  r := make(Metadata, len(md)+len(t.meta))
+  for k, v := range md {
+    r[k] = v
+  }
+  for k, v := range t.meta {
+    r[k] = v
+  }
+  return r
+}
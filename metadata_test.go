@@ -0,0 +1,84 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "fmt"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestMetadata(t *testing.T) {
+
+  p := New(3, 100)
+  g := p.NewJobGroup()
+  e := fmt.Errorf("test error")
+
+  p.SetGroupMetadata(g, Metadata{"request": "r1", "user": "u1"})
+  p.AddJobWithMetadata(g, Metadata{"item": "42", "user": "u2"}, func(pool ThreadPool, erf func() error) error {
+    md := pool.Metadata()
+    if md["request"] != "r1" || md["item"] != "42" || md["user"] != "u2" {
+      t.Errorf("test failed: %v", md)
+    }
+    return e
+  })
+  err := p.Wait(g)
+  if !errors.Is(err, e) || ErrorMetadata(err)["item"] != "42" {
+    t.Errorf("test failed: %v", err)
+  }
+  // single threaded pool
+  err = Nil().AddJobWithMetadata(0, Metadata{"item": "1"}, func(pool ThreadPool, erf func() error) error {
+    if pool.Metadata()["item"] != "1" {
+      t.Error("test failed")
+    }
+    return e
+  })
+  if ErrorMetadata(err)["item"] != "1" || ErrorMetadata(e) != nil {
+    t.Error("test failed")
+  }
+}
+
+func TestMetadataNested(t *testing.T) {
+
+  p := New(3, 100)
+  g := p.NewJobGroup()
+  p.SetGroupName(g, "outer")
+  p.AddJobWithMetadata(g, Metadata{"item": "outer"}, func(pool ThreadPool, erf func() error) error {
+    h := pool.NewJobGroup()
+    pool.SetGroupName(h, "inner")
+    pool.AddRangeJob(0, 10, h, func(i int, pool ThreadPool, erf func() error) error {
+      if i == 7 {
+        return fmt.Errorf("test error")
+      }
+      return nil
+    })
+    return pool.Wait(h)
+  })
+  // errors of nested jobs are not wrapped by the enclosing job
+  err := p.Wait(g)
+  var e *JobError
+  if !errors.As(err, &e) || e.Index != 7 || e.Name != "inner" || ErrorMetadata(err) != nil {
+    t.Errorf("test failed: %v", err)
+  }
+}
@@ -0,0 +1,95 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestNestedPool(t *testing.T) {
+
+  p := New(3, 100)
+  g := p.NewJobGroup()
+
+  p.AddRangeJob(0, 10, g, func(i int, pool ThreadPool, erf func() error) error {
+    q := pool.Nested(4)
+    if q.threadPool != pool.threadPool {
+      t.Error("nested pool does not reuse workers")
+    }
+    if err := q.RangeJob(0, 10, func(j int, pool ThreadPool, erf func() error) error {
+      return nil
+    }); err != nil {
+      t.Error(err)
+    }
+    q.Stop()
+    return nil
+  })
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  // parent pool is still running
+  if err := p.RangeJob(0, 10, func(i int, pool ThreadPool, erf func() error) error {
+    return nil
+  }); err != nil {
+    t.Error(err)
+  }
+  if q := Nil().Nested(2); q.NumberOfThreads() != 1 {
+    t.Error("test failed")
+  }
+  p.Stop()
+}
+
+func TestNestedNew(t *testing.T) {
+
+  p := New(2, 10)
+  g := p.NewJobGroup()
+
+  // pools created with New within jobs have their own workers
+  for i := 0; i < 2; i++ {
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      q := New(3, 10)
+      if q.threadPool == pool.threadPool {
+        t.Error("test failed")
+      }
+      defer q.Stop()
+      return q.RangeJob(0, 10, func(j int, pool ThreadPool, erf func() error) error {
+        time.Sleep(time.Millisecond)
+        return nil
+      })
+    })
+  }
+  done := make(chan error, 1)
+  go func() {
+    done <- p.Wait(g)
+  }()
+  select {
+  case err := <-done:
+    if err != nil {
+      t.Error(err)
+    }
+  case <-time.After(5 * time.Second):
+    t.Fatal("deadlock")
+  }
+  p.Stop()
+}
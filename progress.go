@@ -0,0 +1,177 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "math"
+import "sync/atomic"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Progress callback of a job group
+type progressObserver struct {
+  every int
+  f     func(done, total int)
+  // called when the state of the job group is released
+  close func()
+}
+
+func (obj *progressObserver) notify(done, total int) {
+  if done % obj.every == 0 || done == total {
+    obj.f(done, total)
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Call [f] every [every] finished jobs of [jobGroup] and once all jobs
+// are finished, where [done] is the number of executed jobs and [total]
+// the number of submitted jobs that were not removed from the queue.
+// Note that range jobs are split into chunks, each of which counts as a
+// single job. Calls of [f] are serialized and delay the completion of
+// the job group. The callback is released
+// together with the state of the job group
+func (t *threadPool) OnProgress(jobGroup, every int, f func(done, total int)) {
+  if t == nil {
+    return
+  }
+  if every < 1 {
+    every = 1
+  }
+  t.observe(jobGroup, &progressObserver{every: every, f: f})
+}
+
+func (t *threadPool) observe(jobGroup int, observer *progressObserver) {
+  state := t.getJobGroup(jobGroup)
+  state.errmtx.Lock()
+  state.observers = append(state.observers, observer)
+  atomic.StoreInt32(&state.observed, 1)
+  state.errmtx.Unlock()
+}
+
+// Release progress observers of the group
+func (obj *jobGroupState) releaseObservers() {
+  obj.progmtx.Lock()
+  defer obj.progmtx.Unlock()
+  obj.errmtx.Lock()
+  observers := obj.observers
+  obj.observers = nil
+  obj.errmtx.Unlock()
+  for _, observer := range observers {
+    if observer.close != nil {
+      observer.close()
+    }
+  }
+}
+
+// Called once a job of the group was executed or dropped
+func (obj *jobGroupState) done() {
+  if atomic.LoadInt32(&obj.observed) == 0 {
+    atomic.AddInt64(&obj.finished, 1)
+    obj.wg.Done()
+    return
+  }
+  // callbacks are called before the job is removed from the wait
+  // group, so that they are done when Wait returns
+  obj.progmtx.Lock()
+  defer obj.progmtx.Unlock()
+  done  := int(atomic.AddInt64(&obj.finished, 1))
+  total := done + obj.wg.Value() - 1
+  obj.errmtx.RLock()
+  observers := obj.observers
+  obj.errmtx.RUnlock()
+  for _, observer := range observers {
+    observer.notify(done, total)
+  }
+  obj.wg.Done()
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Progress of a job group
+type ProgressUpdate struct {
+  // number of finished and submitted jobs
+  Done    int           `json:"done"`
+  Total   int           `json:"total"`
+  // time since Progress was called
+  Elapsed time.Duration `json:"elapsed"`
+  // moving average of finished jobs per second
+  Rate    float64       `json:"rate"`
+  // estimated time until all submitted jobs are finished, zero if
+  // unknown
+  ETA     time.Duration `json:"eta"`
+}
+
+// Time constant of the moving average of the job rate
+const progressWindow = 30*time.Second
+
+// Returns a channel that receives an update whenever a job of [jobGroup]
+// is finished. Only the most recent update is kept if the receiver is
+// slow. The channel is closed once the state of the job group is
+// released, i.e. when Wait returns unless KeepState is set
+func (t *threadPool) Progress(jobGroup int) <-chan ProgressUpdate {
+  c := make(chan ProgressUpdate, 1)
+  if t == nil {
+    close(c)
+    return c
+  }
+  start := time.Now()
+  last  := start
+  prev  := 0
+  rate  := 0.0
+  observer := progressObserver{every: 1}
+  observer.f = func(done, total int) {
+    now := time.Now()
+    if dt := now.Sub(last).Seconds(); dt > 0 {
+      // exponential moving average for irregular intervals
+      r := float64(done-prev)/dt
+      if prev == 0 {
+        rate = r
+      } else {
+        w   := 1.0 - math.Exp(-dt/progressWindow.Seconds())
+        rate = w*r + (1.0-w)*rate
+      }
+      last, prev = now, done
+    }
+    u := ProgressUpdate{Done: done, Total: total, Elapsed: now.Sub(start), Rate: rate}
+    if rate > 0 && done < total {
+      u.ETA = time.Duration(float64(total-done)/rate*float64(time.Second))
+    }
+    // replace the previous update if it was not received
+    select {
+    case c <- u:
+    default:
+      select {
+      case <- c:
+      default:
+      }
+      c <- u
+    }
+  }
+  observer.close = func() {
+    close(c)
+  }
+  t.observe(jobGroup, &observer)
+  return c
+}
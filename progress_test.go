@@ -0,0 +1,97 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestOnProgress(t *testing.T) {
+
+  p := New(4, 100)
+  defer p.Stop()
+  g := p.NewJobGroup()
+
+  r := [][2]int{}
+  p.OnProgress(g, 3, func(done, total int) {
+    r = append(r, [2]int{done, total})
+  })
+  for i := 0; i < 10; i++ {
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      time.Sleep(time.Millisecond)
+      return nil
+    })
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  if len(r) != 4 {
+    t.Fatalf("test failed: %v", r)
+  }
+  for i, x := range r[:3] {
+    if x[0] != 3*(i+1) {
+      t.Errorf("test failed: %v", r)
+    }
+  }
+  if r[3] != [2]int{10, 10} {
+    t.Errorf("test failed: %v", r)
+  }
+}
+
+func TestProgress(t *testing.T) {
+
+  p := New(4, 100)
+  defer p.Stop()
+  g := p.NewJobGroup()
+  c := p.Progress(g)
+
+  for i := 0; i < 10; i++ {
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      time.Sleep(time.Millisecond)
+      return nil
+    })
+  }
+  done := make(chan ProgressUpdate)
+  go func() {
+    u := ProgressUpdate{}
+    for u = range c {
+      if u.Done > u.Total || u.Rate <= 0 {
+        t.Errorf("test failed: %+v", u)
+      }
+    }
+    done <- u
+  }()
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  select {
+  case u := <- done:
+    if u.Done != 10 || u.Total != 10 || u.ETA != 0 {
+      t.Errorf("test failed: %+v", u)
+    }
+  case <- time.After(time.Second):
+    t.Error("channel was not closed")
+  }
+}
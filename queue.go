@@ -0,0 +1,587 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "math/rand"
+import "sync"
+import "sync/atomic"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Bounded queue of jobs
+type jobQueue interface {
+  // Append a job to the queue. Returns ErrQueueFull if the queue is full
+  // and ErrStopped if it is closed
+  tryPush(j job) error
+  // Append as many jobs as possible to the queue with a single operation
+  // and return the number of queued jobs
+  tryPushBatch(jobs []job) int
+  // Append a job to the queue. Blocks until there is space in the
+  // queue. Returns ErrStopped if the queue is closed
+  push(j job) error
+  // Same as push, but returns an error that matches ErrQueueFull and
+  // ErrTimeout if there is no space in the queue within [d]
+  pushTimeout(j job, d time.Duration) error
+  // Remove the first job from the queue that may be executed by
+  // [thread]. Blocks until a job is available or the queue is closed
+  // and empty
+  pop(thread int) (job, bool)
+  // Remove the first job from the queue without blocking. Jobs that
+  // are pinned to a worker are skipped
+  tryPop() (job, bool)
+  // Remove the first job from the queue that may be executed by
+  // [thread]. Blocks until a job is available or [done] is closed, in
+  // which case false is returned. If [group] is not nil, only jobs of
+  // this group are removed
+  waitPop(group *jobGroupState, thread int, done <-chan struct{}) (job, bool)
+  // Remove all queued jobs of the given group and return how many
+  // jobs were dropped. Implementations that do not support removal
+  // return zero, in which case jobs of cancelled groups are dropped
+  // once they are dequeued
+  remove(group *jobGroupState) int
+  // Close the queue, workers exit once they observe the closed queue.
+  // Jobs that are still queued are removed by Stop with drain and are
+  // reported as discarded in StopError
+  close()
+  isClosed() bool
+  // Number of queued jobs, which is approximate for lock-free
+  // implementations
+  length() int
+  // Change the capacity of the queue to [n] without dropping queued
+  // jobs. Returns false if the queue cannot be resized
+  resize(n int) bool
+  // Wake all threads that are blocked in pop, which return false
+  // unless a job is available
+  release()
+  // Remove and return all queued jobs, except chunks of gang jobs
+  // that were already started
+  drain() []job
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Bounded FIFO queue of jobs protected by a mutex. In contrast to a
+// channel, jobs that are still queued can be removed again, which is
+// required for cancelling the remaining jobs of a failed job group
+type mutexQueue struct {
+  mtx      sync.Mutex
+  notEmpty sync.Cond
+  notFull  sync.Cond
+  jobs     []job
+  head     int
+  size     int
+  // maximum number of queued jobs, which may be smaller than the
+  // number of queued jobs after the queue was shrunk
+  capacity int
+  closed   bool
+  // closed when a job is pushed, allocated by waitPop
+  avail    chan struct{}
+  // if set, jobs are removed in pseudo-random order
+  random   *rand.Rand
+  // fair scheduling across job groups
+  fair     bool
+  aging    uint64
+  // dispatch most recently queued jobs first
+  lifo     bool
+  // earliest deadline first scheduling
+  edf      bool
+  // number of removed jobs
+  pops     uint64
+  // number of workers blocked in pop
+  idle     int
+  // chunks of started gang jobs that wait for a thread
+  reserved []job
+  // jobs are only accepted if a worker is idle
+  handoff  bool
+  // number of queued jobs with non-zero priority
+  prioritized int
+  // number of queued jobs that are pinned to a worker
+  pinned   int
+  // incremented by release
+  released uint64
+}
+
+func newMutexQueue(bufsize int) *mutexQueue {
+  q := mutexQueue{}
+  q.jobs = make([]job, bufsize)
+  q.capacity = bufsize
+  q.notEmpty.L = &q.mtx
+  q.notFull.L  = &q.mtx
+  return &q
+}
+
+// Queue without buffer that only accepts a job if a worker is blocked
+// in pop, i.e. submitting a job is a direct handoff to an idle worker.
+// Since at most [workers] workers are idle, no more jobs are stored
+func newHandoffQueue(workers int) *mutexQueue {
+  q := newMutexQueue(workers)
+  q.handoff = true
+  return q
+}
+
+// Number of jobs that can be pushed without blocking
+func (q *mutexQueue) freeLocked() int {
+  if q.handoff {
+    // queued jobs are already promised to idle workers
+    if q.idle > q.size {
+      return q.idle - q.size
+    }
+    return 0
+  }
+  if q.capacity > q.size {
+    return q.capacity - q.size
+  }
+  return 0
+}
+
+func (q *mutexQueue) tryPush(j job) error {
+  q.mtx.Lock()
+  defer q.mtx.Unlock()
+  if q.closed {
+    return ErrStopped
+  }
+  if q.freeLocked() == 0 {
+    return ErrQueueFull
+  }
+  q.pushLocked(j)
+  return nil
+}
+
+func (q *mutexQueue) tryPushBatch(jobs []job) int {
+  q.mtx.Lock()
+  defer q.mtx.Unlock()
+  if q.closed {
+    return 0
+  }
+  n := q.freeLocked()
+  if n > len(jobs) {
+    n = len(jobs)
+  }
+  for _, j := range jobs[0:n] {
+    q.pushLocked(j)
+  }
+  return n
+}
+
+func (q *mutexQueue) push(j job) error {
+  q.mtx.Lock()
+  defer q.mtx.Unlock()
+  for !q.closed && q.freeLocked() == 0 {
+    q.notFull.Wait()
+  }
+  if q.closed {
+    return ErrStopped
+  }
+  q.pushLocked(j)
+  return nil
+}
+
+func (q *mutexQueue) pushTimeout(j job, d time.Duration) error {
+  expired := false
+  timer := time.AfterFunc(d, func() {
+    q.mtx.Lock()
+    expired = true
+    q.notFull.Broadcast()
+    q.mtx.Unlock()
+  })
+  defer timer.Stop()
+  q.mtx.Lock()
+  defer q.mtx.Unlock()
+  for !q.closed && q.freeLocked() == 0 && !expired {
+    q.notFull.Wait()
+  }
+  if q.closed {
+    return ErrStopped
+  }
+  if q.freeLocked() == 0 {
+    return errQueueTimeout
+  }
+  q.pushLocked(j)
+  return nil
+}
+
+func (q *mutexQueue) pushLocked(j job) {
+  j.seq = q.pops
+  q.jobs[(q.head+q.size) % len(q.jobs)] = j
+  q.size += 1
+  if j.priority != 0 {
+    q.prioritized += 1
+  }
+  if j.worker != 0 {
+    // the signalled thread might not be the worker
+    // the job is pinned to
+    q.pinned += 1
+    q.notEmpty.Broadcast()
+  } else {
+    q.notEmpty.Signal()
+  }
+  if q.avail != nil {
+    close(q.avail)
+    q.avail = nil
+  }
+}
+
+// Returns the i-th queued job
+func (q *mutexQueue) at(i int) *job {
+  return &q.jobs[(q.head+i) % len(q.jobs)]
+}
+
+// True if the k-th job may be executed by [thread]
+func (q *mutexQueue) eligibleLocked(k, thread int) bool {
+  return q.pinned == 0 || q.at(k).worker == 0 || q.at(k).worker == thread
+}
+
+// Find the first job of [group] that may be executed by [thread]
+func (q *mutexQueue) findLocked(group *jobGroupState, thread int) (int, bool) {
+  for i := 0; i < q.size; i++ {
+    if q.at(i).group == group && q.at(i).gang == nil && q.eligibleLocked(i, thread) {
+      return i, true
+    }
+  }
+  return 0, false
+}
+
+// Remove the k-th job from the queue
+func (q *mutexQueue) removeLocked(k int) job {
+  j := *q.at(k)
+  if k < q.size/2 {
+    // move preceding jobs one position back
+    for i := k; i > 0; i-- {
+      *q.at(i) = *q.at(i-1)
+    }
+    // release references held by the job
+    *q.at(0) = job{}
+    q.head = (q.head+1) % len(q.jobs)
+  } else {
+    // move subsequent jobs one position forward
+    for i := k; i < q.size-1; i++ {
+      *q.at(i) = *q.at(i+1)
+    }
+    // release references held by the job
+    *q.at(q.size-1) = job{}
+  }
+  q.size -= 1
+  q.pops += 1
+  if j.priority != 0 {
+    q.prioritized -= 1
+  }
+  if j.worker != 0 {
+    q.pinned -= 1
+  }
+  q.notFull.Signal()
+  return j
+}
+
+// Select the queued job of the same group as the k-th job with the
+// highest priority, where jobs of equal priority are taken in the order
+// of the scheduling policy
+func (q *mutexQueue) selectPriorityLocked(k int) int {
+  if q.prioritized == 0 || q.at(k).gang != nil {
+    return k
+  }
+  group := q.at(k).group
+  for i := 0; i < q.size; i++ {
+    if j := q.at(i); j.group == group && j.gang == nil && j.priority > q.at(k).priority {
+      k = i
+    }
+  }
+  return k
+}
+
+// Select the job with the least recently served group. Jobs that have
+// been waiting too long are served in FIFO order
+func (q *mutexQueue) selectFairLocked() int {
+  if q.pops - q.at(0).seq >= q.aging {
+    return 0
+  }
+  k := 0
+  for i := 1; i < q.size; i++ {
+    if q.at(i).group.served < q.at(k).group.served {
+      k = i
+    }
+  }
+  return k
+}
+
+// Select the queued job whose group has the earliest deadline. Returns
+// false if no queued job has a deadline
+func (q *mutexQueue) selectDeadlineLocked() (int, bool) {
+  k := -1
+  d := int64(0)
+  for i := 0; i < q.size; i++ {
+    if di := atomic.LoadInt64(&q.at(i).group.deadline); di != 0 && (k < 0 || di < d) {
+      k, d = i, di
+    }
+  }
+  return k, k >= 0
+}
+
+// Select the next job according to the scheduling policy
+func (q *mutexQueue) selectLocked() int {
+  if q.edf && q.random == nil {
+    if k, ok := q.selectDeadlineLocked(); ok {
+      return q.selectPriorityLocked(k)
+    }
+  }
+  k := 0
+  switch {
+  case q.random != nil:
+    k = q.random.Intn(q.size)
+  case q.fair:
+    k = q.selectFairLocked()
+    if q.lifo {
+      // most recent job of the selected group
+      for i := q.size-1; i > k; i-- {
+        if q.at(i).group == q.at(k).group {
+          k = i; break
+        }
+      }
+    }
+  case q.lifo:
+    k = q.size-1
+  }
+  return q.selectPriorityLocked(k)
+}
+
+// Remove the next job from the queue. Chunks of started gang jobs are
+// removed first. A gang job is only started by a worker and only if
+// enough workers are idle to execute all chunks at the same time, in
+// which case the remaining chunks are reserved for the next threads
+// that remove jobs. Jobs pinned to other workers than [thread] are
+// skipped. Returns false if no job can be removed
+func (q *mutexQueue) popLocked(worker bool, thread int) (job, bool) {
+  if len(q.reserved) > 0 {
+    j := q.reserved[0]
+    q.reserved[0] = job{}
+    q.reserved = q.reserved[1:]
+    return j, true
+  }
+  if q.size == 0 {
+    return job{}, false
+  }
+  k := q.selectLocked()
+  if !q.startableLocked(k, worker, thread) {
+    // take the first job that can be started by this thread, gang
+    // jobs that cannot start yet must not block the jobs behind
+    // them, which might be waited for by running jobs
+    if k = q.firstStartableLocked(worker, thread); k < 0 {
+      return job{}, false
+    }
+  }
+  j := q.removeLocked(k)
+  if q.fair {
+    j.group.served = q.pops
+  }
+  if j.gang != nil {
+    j.group.barrier.join(len(j.gang))
+    q.reserved = append(q.reserved, j.gang[1:]...)
+    q.notEmpty.Broadcast()
+    return j.gang[0], true
+  }
+  return j, true
+}
+
+// True if the k-th job can be started by [thread]. Gang jobs are only
+// started by workers and only if enough workers are idle
+func (q *mutexQueue) startableLocked(k int, worker bool, thread int) bool {
+  if gang := q.at(k).gang; gang != nil && (!worker || q.idle+1 < len(gang)) {
+    return false
+  }
+  return q.eligibleLocked(k, thread)
+}
+
+// Returns the first job that can be started by [thread], or -1 if
+// there is none
+func (q *mutexQueue) firstStartableLocked(worker bool, thread int) int {
+  for i := 0; i < q.size; i++ {
+    if q.startableLocked(i, worker, thread) {
+      return i
+    }
+  }
+  return -1
+}
+
+func (q *mutexQueue) pop(thread int) (job, bool) {
+  q.mtx.Lock()
+  defer q.mtx.Unlock()
+  released := q.released
+  for {
+    if j, ok := q.popLocked(true, thread); ok {
+      return j, true
+    }
+    if q.closed && q.size == 0 || q.released != released {
+      return job{}, false
+    }
+    q.idle += 1
+    if q.handoff {
+      // wake a thread that waits for an idle worker
+      q.notFull.Signal()
+    }
+    q.notEmpty.Wait()
+    q.idle -= 1
+  }
+}
+
+func (q *mutexQueue) tryPop() (job, bool) {
+  q.mtx.Lock()
+  defer q.mtx.Unlock()
+  return q.popLocked(false, 0)
+}
+
+func (q *mutexQueue) waitPop(group *jobGroupState, thread int, done <-chan struct{}) (job, bool) {
+  for {
+    select {
+    case <- done:
+      return job{}, false
+    default:
+    }
+    q.mtx.Lock()
+    if group == nil {
+      if j, ok := q.popLocked(false, thread); ok {
+        q.mtx.Unlock()
+        return j, true
+      }
+    }
+    if group != nil {
+      if k, ok := q.findLocked(group, thread); ok {
+        j := q.removeLocked(q.selectPriorityLocked(k))
+        q.mtx.Unlock()
+        return j, true
+      }
+    }
+    if q.avail == nil {
+      q.avail = make(chan struct{})
+    }
+    avail := q.avail
+    q.mtx.Unlock()
+    select {
+    case <- avail:
+    case <- done:
+      return job{}, false
+    }
+  }
+}
+
+func (q *mutexQueue) remove(group *jobGroupState) int {
+  q.mtx.Lock()
+  n := 0
+  r := 0
+  finish := []func(){}
+  for i := 0; i < q.size; i++ {
+    j := *q.at(i)
+    if j.group == group {
+      if j.gang != nil {
+        r += len(j.gang)
+      } else {
+        r += 1
+      }
+      if j.priority != 0 {
+        q.prioritized -= 1
+      }
+      if j.worker != 0 {
+        q.pinned -= 1
+      }
+      if j.finish != nil {
+        finish = append(finish, j.finish)
+      }
+      continue
+    }
+    *q.at(n) = j
+    n += 1
+  }
+  for i := n; i < q.size; i++ {
+    *q.at(i) = job{}
+  }
+  if q.size > n {
+    q.notFull.Broadcast()
+  }
+  q.size = n
+  q.mtx.Unlock()
+  // finish dropped jobs outside the lock, since
+  // they may submit further jobs
+  for _, f := range finish {
+    f()
+  }
+  return r
+}
+
+func (q *mutexQueue) length() int {
+  q.mtx.Lock()
+  defer q.mtx.Unlock()
+  return q.size
+}
+
+func (q *mutexQueue) resize(n int) bool {
+  q.mtx.Lock()
+  defer q.mtx.Unlock()
+  if q.handoff {
+    return false
+  }
+  // keep queued jobs even if they exceed the new capacity
+  jobs := make([]job, n)
+  if n < q.size {
+    jobs = make([]job, q.size)
+  }
+  for i := 0; i < q.size; i++ {
+    jobs[i] = *q.at(i)
+  }
+  q.jobs     = jobs
+  q.head     = 0
+  q.capacity = n
+  q.notFull.Broadcast()
+  return true
+}
+
+func (q *mutexQueue) close() {
+  q.mtx.Lock()
+  defer q.mtx.Unlock()
+  q.closed = true
+  q.notEmpty.Broadcast()
+  q.notFull.Broadcast()
+}
+
+func (q *mutexQueue) drain() []job {
+  q.mtx.Lock()
+  defer q.mtx.Unlock()
+  r := make([]job, 0, q.size)
+  for q.size > 0 {
+    r = append(r, q.removeLocked(0))
+  }
+  q.notFull.Broadcast()
+  return r
+}
+
+func (q *mutexQueue) release() {
+  q.mtx.Lock()
+  defer q.mtx.Unlock()
+  q.released += 1
+  q.notEmpty.Broadcast()
+}
+
+func (q *mutexQueue) isClosed() bool {
+  q.mtx.Lock()
+  defer q.mtx.Unlock()
+  return q.closed
+}
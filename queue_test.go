@@ -0,0 +1,253 @@
+/* Copyright (C) 2017-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestQueueBatch(t *testing.T) {
+
+  for _, q := range []jobQueue{newMutexQueue(10), newRingQueue(10)} {
+    jobs := make([]job, 8)
+    for i := range jobs {
+      jobs[i].jobGroup = i
+    }
+    if n := q.tryPushBatch(jobs); n != 8 {
+      t.Errorf("test failed: %d", n)
+    }
+    if n := q.tryPushBatch(jobs); n != 2 {
+      t.Errorf("test failed: %d", n)
+    }
+    for i := 0; i < 10; i++ {
+      if j, ok := q.tryPop(); !ok || j.jobGroup != i % 8 {
+        t.Error("test failed")
+      }
+    }
+    if _, ok := q.tryPop(); ok {
+      t.Error("test failed")
+    }
+    q.close()
+    if n := q.tryPushBatch(jobs); n != 0 {
+      t.Errorf("test failed: %d", n)
+    }
+  }
+}
+
+func TestQueueWaitPop(t *testing.T) {
+
+  for _, q := range []jobQueue{newMutexQueue(10), newRingQueue(10)} {
+    done := make(chan struct{})
+    go func() {
+      time.Sleep(10 * time.Millisecond)
+      q.tryPush(job{jobGroup: 1})
+    }()
+    if j, ok := q.waitPop(nil, 0, done); !ok || j.jobGroup != 1 {
+      t.Error("test failed")
+    }
+    go func() {
+      time.Sleep(10 * time.Millisecond)
+      close(done)
+    }()
+    if _, ok := q.waitPop(nil, 0, done); ok {
+      t.Error("test failed")
+    }
+  }
+}
+
+func TestQueueWaitPopGroup(t *testing.T) {
+
+  q    := newMutexQueue(10)
+  done := make(chan struct{})
+  g1   := newJobGroupState()
+  g2   := newJobGroupState()
+
+  q.tryPush(job{jobGroup: 1, group: g1})
+  q.tryPush(job{jobGroup: 2, group: g2})
+  q.tryPush(job{jobGroup: 3, group: g1})
+  q.tryPush(job{jobGroup: 4, group: g2})
+
+  for _, i := range []int{2, 4} {
+    if j, ok := q.waitPop(g2, 0, done); !ok || j.jobGroup != i {
+      t.Error("test failed")
+    }
+  }
+  for _, i := range []int{1, 3} {
+    if j, ok := q.tryPop(); !ok || j.jobGroup != i {
+      t.Error("test failed")
+    }
+  }
+}
+
+func TestQueueFair(t *testing.T) {
+
+  q := newMutexQueue(20)
+  q.fair  = true
+  q.aging = 100
+
+  g1 := newJobGroupState()
+  g2 := newJobGroupState()
+  for i := 0; i < 10; i++ {
+    q.tryPush(job{jobGroup: 1, group: g1})
+  }
+  for i := 0; i < 2; i++ {
+    q.tryPush(job{jobGroup: 2, group: g2})
+  }
+  r := []int{}
+  for {
+    j, ok := q.tryPop()
+    if !ok {
+      break
+    }
+    r = append(r, j.jobGroup)
+  }
+  s := []int{1, 2, 1, 2, 1, 1, 1, 1, 1, 1, 1, 1}
+  for i := range s {
+    if r[i] != s[i] {
+      t.Errorf("test failed: %v", r)
+      break
+    }
+  }
+}
+
+func TestQueueFairAging(t *testing.T) {
+
+  q := newMutexQueue(20)
+  q.fair  = true
+  q.aging = 2
+
+  g := []*jobGroupState{newJobGroupState(), newJobGroupState(), newJobGroupState()}
+  // the second job of group 0 is dispatched after at most two
+  // other jobs were dispatched
+  q.tryPush(job{jobGroup: 0, group: g[0]})
+  q.tryPush(job{jobGroup: 0, group: g[0]})
+  q.tryPop()
+  for i := 0; i < 4; i++ {
+    q.tryPush(job{jobGroup: 1+i%2, group: g[1+i%2]})
+  }
+  r := []int{}
+  for {
+    j, ok := q.tryPop()
+    if !ok {
+      break
+    }
+    r = append(r, j.jobGroup)
+  }
+  s := []int{1, 0, 2, 1, 2}
+  for i := range s {
+    if r[i] != s[i] {
+      t.Errorf("test failed: %v", r)
+      break
+    }
+  }
+}
+
+func TestQueueLIFO(t *testing.T) {
+
+  q := newMutexQueue(10)
+  q.lifo = true
+
+  for i := 0; i < 5; i++ {
+    q.tryPush(job{jobGroup: i})
+  }
+  for i := 4; i >= 0; i-- {
+    if j, ok := q.tryPop(); !ok || j.jobGroup != i {
+      t.Error("test failed")
+    }
+  }
+}
+
+func TestQueueDeadline(t *testing.T) {
+
+  q := newMutexQueue(10)
+  q.edf = true
+
+  groups := []*jobGroupState{newJobGroupState(), newJobGroupState(), newJobGroupState()}
+  groups[1].deadline = 200
+  groups[2].deadline = 100
+
+  for i := 0; i < 6; i++ {
+    q.tryPush(job{jobGroup: i % 3, group: groups[i % 3]})
+  }
+  // jobs without deadline are dispatched last in FIFO order
+  for _, g := range []int{2, 2, 1, 1, 0, 0} {
+    if j, ok := q.tryPop(); !ok || j.jobGroup != g {
+      t.Error("test failed")
+    }
+  }
+}
+
+func TestQueueResize(t *testing.T) {
+
+  q := newMutexQueue(4)
+
+  for i := 0; i < 4; i++ {
+    q.tryPush(job{jobGroup: i})
+  }
+  q.tryPop()
+  q.tryPush(job{jobGroup: 4})
+  // queued jobs are kept if the queue is shrunk
+  q.resize(2)
+  if err := q.tryPush(job{jobGroup: 5}); err != ErrQueueFull {
+    t.Error("test failed")
+  }
+  q.resize(8)
+  for i := 5; i < 9; i++ {
+    if err := q.tryPush(job{jobGroup: i}); err != nil {
+      t.Error("test failed")
+    }
+  }
+  for i := 1; i < 9; i++ {
+    if j, ok := q.tryPop(); !ok || j.jobGroup != i {
+      t.Error("test failed")
+    }
+  }
+  if newRingQueue(4).resize(8) {
+    t.Error("test failed")
+  }
+}
+
+func TestQueuePriority(t *testing.T) {
+
+  q := newMutexQueue(10)
+
+  g1 := newJobGroupState()
+  g2 := newJobGroupState()
+  q.tryPush(job{jobGroup: 1, group: g1, index: 0})
+  q.tryPush(job{jobGroup: 2, group: g2, index: 1, priority: 5})
+  q.tryPush(job{jobGroup: 1, group: g1, index: 2, priority: 1})
+  q.tryPush(job{jobGroup: 1, group: g1, index: 3, priority: 2})
+  q.tryPush(job{jobGroup: 1, group: g1, index: 4, priority: 2})
+
+  // priorities only apply within job groups
+  for _, i := range []int{3, 4, 2, 0, 1} {
+    if j, ok := q.tryPop(); !ok || j.index != i {
+      t.Errorf("test failed: %d", j.index)
+    }
+  }
+  if q.prioritized != 0 {
+    t.Error("test failed")
+  }
+}
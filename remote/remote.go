@@ -0,0 +1,304 @@
+//go:build go1.16
+// +build go1.16
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package remote allows remote worker processes to execute jobs of a
+// thread pool. Jobs are described by a name and a serialized payload.
+// Remote workers connect to a Coordinator over TCP using net/rpc, pull
+// jobs and return their results, while the local code uses the usual
+// job groups and Wait of the thread pool. The transport is net/rpc instead
+// of gRPC on purpose, so that the module has no dependencies outside the
+// standard library.
+package remote
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "fmt"
+import "net"
+import "net/rpc"
+import "sync"
+import "time"
+
+import "github.com/pbenner/threadpool"
+
+/* -------------------------------------------------------------------------- */
+
+// Job sent to remote workers
+type Task struct {
+  Id      uint64
+  Name    string
+  Payload []byte
+}
+
+// Result returned by remote workers
+type Result struct {
+  Id      uint64
+  Payload []byte
+  Error   string
+}
+
+// Executes a job on a remote worker
+type Handler func(payload []byte) ([]byte, error)
+
+/* -------------------------------------------------------------------------- */
+
+type pendingTask struct {
+  task   Task
+  done   func(error)
+  result func(payload []byte) error
+  // connection of the worker that pulled the task, nil
+  // if the task is queued
+  owner  *service
+  timer  *time.Timer
+}
+
+// Distributes jobs of a thread pool to remote workers. Jobs that are
+// in flight on a worker whose connection is lost, or that are not completed
+// within the lease, are dispatched again
+type Coordinator struct {
+  pool    threadpool.ThreadPool
+  tasks   chan Task
+  mtx     sync.Mutex
+  next    uint64
+  lease   time.Duration
+  pending map[uint64]pendingTask
+}
+
+// Create a coordinator for jobs of [pool]. At most [bufsize] jobs wait for
+// a remote worker, further calls of AddJob block
+func NewCoordinator(pool threadpool.ThreadPool, bufsize int) *Coordinator {
+  return &Coordinator{
+    pool   : pool,
+    tasks  : make(chan Task, bufsize),
+    pending: make(map[uint64]pendingTask)}
+}
+
+// Dispatch jobs again that are not completed within [d] after they were
+// pulled by a worker, for instance because the worker hangs. The result of
+// the first worker that completes the job is used. Zero, the default, only
+// dispatches jobs again if the connection of the worker is lost
+func (c *Coordinator) SetLease(d time.Duration) {
+  c.mtx.Lock()
+  c.lease = d
+  c.mtx.Unlock()
+}
+
+// Submit a job to the remote workers, where [name] selects the handler of
+// the worker. The job is counted as a job of [jobGroup], i.e. Wait returns
+// once the job is done. The output of the handler is passed to [result],
+// which is called on the coordinator and may return an error
+func (c *Coordinator) AddJob(jobGroup int, name string, payload []byte, result func(payload []byte) error) error {
+  done, err := c.pool.AddAsyncJob(jobGroup)
+  if err != nil {
+    return err
+  }
+  c.mtx.Lock()
+  c.next += 1
+  id := c.next
+  task := Task{Id: id, Name: name, Payload: payload}
+  c.pending[id] = pendingTask{task: task, done: done, result: result}
+  c.mtx.Unlock()
+  c.tasks <- task
+  return nil
+}
+
+// Record that [task] was pulled by the worker connected to [s]
+func (c *Coordinator) leased(s *service, task Task) {
+  c.mtx.Lock()
+  defer c.mtx.Unlock()
+  p, ok := c.pending[task.Id]
+  if !ok {
+    return
+  }
+  p.owner = s
+  if c.lease > 0 {
+    p.timer = time.AfterFunc(c.lease, func() {
+      c.requeue(s, task.Id)
+    })
+  }
+  c.pending[task.Id] = p
+}
+
+// Dispatch task [id] again if it is still in flight on the worker
+// connected to [s]
+func (c *Coordinator) requeue(s *service, id uint64) {
+  c.mtx.Lock()
+  p, ok := c.pending[id]
+  if !ok || p.owner != s {
+    c.mtx.Unlock()
+    return
+  }
+  if p.timer != nil {
+    p.timer.Stop()
+  }
+  p.owner = nil
+  p.timer = nil
+  c.pending[id] = p
+  c.mtx.Unlock()
+  // do not block the caller if the buffer is full
+  go func() {
+    c.tasks <- p.task
+  }()
+}
+
+// Dispatch all tasks again that are in flight on the worker connected
+// to [s], called once the connection is lost
+func (c *Coordinator) release(s *service) {
+  c.mtx.Lock()
+  ids := []uint64{}
+  for id, p := range c.pending {
+    if p.owner == s {
+      ids = append(ids, id)
+    }
+  }
+  c.mtx.Unlock()
+  for _, id := range ids {
+    c.requeue(s, id)
+  }
+}
+
+// Results of tasks that are no longer pending, i.e. tasks that were
+// dispatched again and completed by another worker, are ignored
+func (c *Coordinator) complete(r Result) error {
+  c.mtx.Lock()
+  p, ok := c.pending[r.Id]
+  delete(c.pending, r.Id)
+  c.mtx.Unlock()
+  if !ok {
+    return nil
+  }
+  if p.timer != nil {
+    p.timer.Stop()
+  }
+  if r.Error != "" {
+    p.done(errors.New(r.Error))
+  } else if p.result != nil {
+    p.done(p.result(r.Payload))
+  } else {
+    p.done(nil)
+  }
+  return nil
+}
+
+// Accept connections of remote workers on [l]. Blocks until the listener
+// is closed, in which case nil is returned, or accepting a connection fails
+func (c *Coordinator) Serve(l net.Listener) error {
+  for {
+    conn, err := l.Accept()
+    if errors.Is(err, net.ErrClosed) {
+      return nil
+    }
+    if err != nil {
+      return err
+    }
+    go c.serveConn(conn)
+  }
+}
+
+// Serve a single worker, jobs that are in flight on the worker are
+// dispatched again once the connection is lost
+func (c *Coordinator) serveConn(conn net.Conn) {
+  s := &service{c: c}
+  server := rpc.NewServer()
+  if err := server.RegisterName("Coordinator", s); err != nil {
+    conn.Close()
+    return
+  }
+  server.ServeConn(conn)
+  c.release(s)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Time after which Pull returns without a task, so that workers notice a
+// lost connection
+const pollTimeout = time.Second
+
+// Methods exported by the coordinator over net/rpc, one service is created
+// for each connection
+type service struct {
+  c *Coordinator
+}
+
+func (s *service) Pull(worker string, task *Task) error {
+  select {
+  case *task = <- s.c.tasks:
+    s.c.leased(s, *task)
+  case <- time.After(pollTimeout):
+    // no task available, id zero
+    *task = Task{}
+  }
+  return nil
+}
+
+func (s *service) Complete(r Result, reply *bool) error {
+  *reply = true
+  return s.c.complete(r)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Connect to the coordinator at [addr] and execute jobs with [threads]
+// parallel threads. Jobs are dispatched to [handlers] by name. Returns
+// once the connection is lost
+func Work(addr, worker string, threads int, handlers map[string]Handler) error {
+  client, err := rpc.Dial("tcp", addr)
+  if err != nil {
+    return err
+  }
+  defer client.Close()
+
+  errs := make(chan error, threads)
+  for i := 0; i < threads; i++ {
+    go func() {
+      errs <- work(client, worker, handlers)
+    }()
+  }
+  // stop as soon as one thread fails
+  return <- errs
+}
+
+func work(client *rpc.Client, worker string, handlers map[string]Handler) error {
+  for {
+    task := Task{}
+    if err := client.Call("Coordinator.Pull", worker, &task); err != nil {
+      return err
+    }
+    if task.Id == 0 {
+      continue
+    }
+    r := Result{Id: task.Id}
+    if h, ok := handlers[task.Name]; !ok {
+      r.Error = fmt.Sprintf("remote: no handler for job `%s'", task.Name)
+    } else if payload, err := h(task.Payload); err != nil {
+      r.Error = err.Error()
+    } else {
+      r.Payload = payload
+    }
+    reply := false
+    if err := client.Call("Coordinator.Complete", r, &reply); err != nil {
+      return err
+    }
+  }
+}
@@ -0,0 +1,184 @@
+//go:build go1.16
+// +build go1.16
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package remote
+
+/* -------------------------------------------------------------------------- */
+
+import "bytes"
+import "errors"
+import "fmt"
+import "net"
+import "net/rpc"
+import "testing"
+import "time"
+
+import "github.com/pbenner/threadpool"
+
+/* -------------------------------------------------------------------------- */
+
+func TestRemote(t *testing.T) {
+
+  l, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    t.Skip(err)
+  }
+  defer l.Close()
+
+  p := threadpool.New(2, 100)
+  c := NewCoordinator(p, 100)
+  go c.Serve(l)
+
+  handlers := map[string]Handler{
+    "upper": func(payload []byte) ([]byte, error) {
+      return bytes.ToUpper(payload), nil
+    },
+    "fail": func(payload []byte) ([]byte, error) {
+      return nil, fmt.Errorf("job failed")
+    },
+  }
+  go Work(l.Addr().String(), "worker", 4, handlers)
+
+  g := p.NewJobGroup()
+  r := make([]string, 10)
+  for i := range r {
+    i := i
+    c.AddJob(g, "upper", []byte(fmt.Sprintf("job%d", i)), func(payload []byte) error {
+      r[i] = string(payload)
+      return nil
+    })
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  for i := range r {
+    if r[i] != fmt.Sprintf("JOB%d", i) {
+      t.Errorf("test failed: %v", r)
+    }
+  }
+  g = p.NewJobGroup()
+  c.AddJob(g, "fail", nil, nil)
+  c.AddJob(g, "unknown", nil, nil)
+  if err := p.Wait(g); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestRemoteFailure(t *testing.T) {
+
+  l, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    t.Skip(err)
+  }
+  defer l.Close()
+
+  p := threadpool.New(2, 100)
+  c := NewCoordinator(p, 100)
+  c.SetLease(100*time.Millisecond)
+  go c.Serve(l)
+
+  g := p.NewJobGroup()
+  r := make([]string, 10)
+  for i := range r {
+    i := i
+    c.AddJob(g, "upper", []byte(fmt.Sprintf("job%d", i)), func(payload []byte) error {
+      r[i] = string(payload)
+      return nil
+    })
+  }
+  // a worker that dies after pulling a task
+  client, err := rpc.Dial("tcp", l.Addr().String())
+  if err != nil {
+    t.Fatal(err)
+  }
+  task := Task{}
+  if err := client.Call("Coordinator.Pull", "dying", &task); err != nil || task.Id == 0 {
+    t.Fatal("test failed")
+  }
+  client.Close()
+  // a worker that hangs after pulling a task
+  client, err = rpc.Dial("tcp", l.Addr().String())
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer client.Close()
+  if err := client.Call("Coordinator.Pull", "hanging", &task); err != nil || task.Id == 0 {
+    t.Fatal("test failed")
+  }
+  handlers := map[string]Handler{
+    "upper": func(payload []byte) ([]byte, error) {
+      return bytes.ToUpper(payload), nil
+    },
+  }
+  go Work(l.Addr().String(), "worker", 2, handlers)
+
+  done := make(chan error, 1)
+  go func() {
+    done <- p.Wait(g)
+  }()
+  select {
+  case err := <-done:
+    if err != nil {
+      t.Error(err)
+    }
+  case <-time.After(5 * time.Second):
+    t.Fatal("jobs of failed workers were not dispatched again")
+  }
+  for i := range r {
+    if r[i] != fmt.Sprintf("JOB%d", i) {
+      t.Errorf("test failed: %v", r)
+    }
+  }
+  // late results of the hanging worker are ignored
+  reply := false
+  if err := client.Call("Coordinator.Complete", Result{Id: task.Id}, &reply); err != nil {
+    t.Error(err)
+  }
+}
+
+type failingListener struct {
+  net.Listener
+}
+
+func (l failingListener) Accept() (net.Conn, error) {
+  return nil, errors.New("accept failed")
+}
+
+func TestServe(t *testing.T) {
+
+  l, err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    t.Skip(err)
+  }
+  c := NewCoordinator(threadpool.New(2, 10), 10)
+  // errors of the listener are returned
+  if err := c.Serve(failingListener{l}); err == nil || err.Error() != "accept failed" {
+    t.Errorf("test failed: %v", err)
+  }
+  // closing the listener is not an error
+  l.Close()
+  if err := c.Serve(l); err != nil {
+    t.Error(err)
+  }
+}
@@ -0,0 +1,322 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "runtime"
+import "sync"
+import "sync/atomic"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Bounded lock-free multi-producer multi-consumer queue (D. Vyukov). Each
+// cell of the ring buffer carries a sequence number that tells producers
+// and consumers whether the cell is free or holds a job at the current
+// position. Threads only take the mutex when they have to block because
+// the queue is empty or full
+type ringQueue struct {
+  // next position to dequeue
+  head      uint64
+  _         [56]byte
+  // next position to enqueue
+  tail      uint64
+  _         [56]byte
+  // incremented by release, placed here for 64-bit alignment
+  released  uint64
+  seqs      []uint64
+  jobs      []job
+  // number of pushes in progress
+  pushing   int32
+  // closed is set when the queue is closed, finished is set
+  // once all pushes in progress have completed
+  closed    int32
+  finished  int32
+  // blocked producers and consumers
+  mtx       sync.Mutex
+  notEmpty  sync.Cond
+  notFull   sync.Cond
+  consumers int32
+  producers int32
+  // threads blocked in waitPop, which are notified by closing
+  // the avail channel
+  waiters   int32
+  avail     chan struct{}
+}
+
+func newRingQueue(bufsize int) *ringQueue {
+  if bufsize < 2 {
+    bufsize = 2
+  }
+  q := ringQueue{}
+  q.seqs = make([]uint64, bufsize)
+  q.jobs = make([]job, bufsize)
+  for i := range q.seqs {
+    q.seqs[i] = uint64(i)
+  }
+  q.notEmpty.L = &q.mtx
+  q.notFull.L  = &q.mtx
+  return &q
+}
+
+func (q *ringQueue) tryPush(j job) error {
+  atomic.AddInt32(&q.pushing, 1)
+  defer atomic.AddInt32(&q.pushing, -1)
+  if atomic.LoadInt32(&q.closed) != 0 {
+    return ErrStopped
+  }
+  n   := uint64(len(q.seqs))
+  pos := atomic.LoadUint64(&q.tail)
+  for {
+    i   := pos % n
+    seq := atomic.LoadUint64(&q.seqs[i])
+    if d := int64(seq - pos); d == 0 {
+      if atomic.CompareAndSwapUint64(&q.tail, pos, pos+1) {
+        q.jobs[i] = j
+        atomic.StoreUint64(&q.seqs[i], pos+1)
+        q.wake(&q.notEmpty, &q.consumers)
+        q.wakeWaiters()
+        return nil
+      }
+    } else if d < 0 {
+      return ErrQueueFull
+    }
+    pos = atomic.LoadUint64(&q.tail)
+  }
+}
+
+func (q *ringQueue) tryPushBatch(jobs []job) int {
+  for i, j := range jobs {
+    if q.tryPush(j) != nil {
+      return i
+    }
+  }
+  return len(jobs)
+}
+
+func (q *ringQueue) tryPop() (job, bool) {
+  n   := uint64(len(q.seqs))
+  pos := atomic.LoadUint64(&q.head)
+  for {
+    i   := pos % n
+    seq := atomic.LoadUint64(&q.seqs[i])
+    if d := int64(seq - (pos+1)); d == 0 {
+      if atomic.CompareAndSwapUint64(&q.head, pos, pos+1) {
+        j := q.jobs[i]
+        // release references held by the job
+        q.jobs[i] = job{}
+        atomic.StoreUint64(&q.seqs[i], pos+n)
+        q.wake(&q.notFull, &q.producers)
+        return j, true
+      }
+    } else if d < 0 {
+      return job{}, false
+    }
+    pos = atomic.LoadUint64(&q.head)
+  }
+}
+
+func (q *ringQueue) push(j job) error {
+  for {
+    if err := q.tryPush(j); err != ErrQueueFull {
+      return err
+    }
+    q.block(&q.notFull, &q.producers, func() bool {
+      return !q.full() || atomic.LoadInt32(&q.closed) != 0
+    })
+  }
+}
+
+func (q *ringQueue) pushTimeout(j job, d time.Duration) error {
+  expired := int32(0)
+  timer := time.AfterFunc(d, func() {
+    q.mtx.Lock()
+    atomic.StoreInt32(&expired, 1)
+    q.notFull.Broadcast()
+    q.mtx.Unlock()
+  })
+  defer timer.Stop()
+  for {
+    err := q.tryPush(j)
+    if err != ErrQueueFull {
+      return err
+    }
+    if atomic.LoadInt32(&expired) != 0 {
+      return errQueueTimeout
+    }
+    q.block(&q.notFull, &q.producers, func() bool {
+      return !q.full() || atomic.LoadInt32(&q.closed) != 0 || atomic.LoadInt32(&expired) != 0
+    })
+  }
+}
+
+func (q *ringQueue) pop(thread int) (job, bool) {
+  released := atomic.LoadUint64(&q.released)
+  for {
+    if j, ok := q.tryPop(); ok {
+      return j, true
+    }
+    if atomic.LoadInt32(&q.finished) != 0 || atomic.LoadUint64(&q.released) != released {
+      // no more jobs can arrive, but a job might have been
+      // pushed since the last attempt
+      return q.tryPop()
+    }
+    q.block(&q.notEmpty, &q.consumers, func() bool {
+      return !q.empty() || atomic.LoadInt32(&q.finished) != 0 || atomic.LoadUint64(&q.released) != released
+    })
+  }
+}
+
+func (q *ringQueue) waitPop(group *jobGroupState, thread int, done <-chan struct{}) (job, bool) {
+  if group != nil {
+    // jobs cannot be removed from the middle of the queue
+    <- done
+    return job{}, false
+  }
+  for {
+    select {
+    case <- done:
+      return job{}, false
+    default:
+    }
+    if j, ok := q.tryPop(); ok {
+      return j, true
+    }
+    q.mtx.Lock()
+    atomic.AddInt32(&q.waiters, 1)
+    if !q.empty() {
+      atomic.AddInt32(&q.waiters, -1)
+      q.mtx.Unlock()
+      continue
+    }
+    if q.avail == nil {
+      q.avail = make(chan struct{})
+    }
+    avail := q.avail
+    q.mtx.Unlock()
+    select {
+    case <- avail:
+    case <- done:
+    }
+    atomic.AddInt32(&q.waiters, -1)
+  }
+}
+
+func (q *ringQueue) remove(group *jobGroupState) int {
+  return 0
+}
+
+func (q *ringQueue) close() {
+  if !atomic.CompareAndSwapInt32(&q.closed, 0, 1) {
+    return
+  }
+  // wait for pushes in progress
+  for atomic.LoadInt32(&q.pushing) != 0 {
+    runtime.Gosched()
+  }
+  q.mtx.Lock()
+  atomic.StoreInt32(&q.finished, 1)
+  q.notEmpty.Broadcast()
+  q.notFull.Broadcast()
+  q.mtx.Unlock()
+}
+
+func (q *ringQueue) drain() []job {
+  r := []job{}
+  for {
+    j, ok := q.tryPop()
+    if !ok {
+      return r
+    }
+    r = append(r, j)
+  }
+}
+
+func (q *ringQueue) release() {
+  q.mtx.Lock()
+  atomic.AddUint64(&q.released, 1)
+  q.notEmpty.Broadcast()
+  q.mtx.Unlock()
+}
+
+func (q *ringQueue) isClosed() bool {
+  return atomic.LoadInt32(&q.closed) != 0
+}
+
+/* -------------------------------------------------------------------------- */
+
+func (q *ringQueue) length() int {
+  head := atomic.LoadUint64(&q.head)
+  tail := atomic.LoadUint64(&q.tail)
+  if tail < head {
+    return 0
+  }
+  return int(tail - head)
+}
+
+// The ring buffer cannot be replaced while producers and consumers
+// access it without holding a lock
+func (q *ringQueue) resize(n int) bool {
+  return false
+}
+
+func (q *ringQueue) empty() bool {
+  pos := atomic.LoadUint64(&q.head)
+  return atomic.LoadUint64(&q.seqs[pos % uint64(len(q.seqs))]) != pos+1
+}
+
+func (q *ringQueue) full() bool {
+  pos := atomic.LoadUint64(&q.tail)
+  return atomic.LoadUint64(&q.seqs[pos % uint64(len(q.seqs))]) != pos
+}
+
+// Block on [cond] unless [ready] returns true. The waiter is registered
+// before [ready] is checked, so that a concurrent wake cannot be lost
+func (q *ringQueue) block(cond *sync.Cond, waiting *int32, ready func() bool) {
+  q.mtx.Lock()
+  atomic.AddInt32(waiting, 1)
+  if !ready() {
+    cond.Wait()
+  }
+  atomic.AddInt32(waiting, -1)
+  q.mtx.Unlock()
+}
+
+func (q *ringQueue) wakeWaiters() {
+  if atomic.LoadInt32(&q.waiters) > 0 {
+    q.mtx.Lock()
+    if q.avail != nil {
+      close(q.avail)
+      q.avail = nil
+    }
+    q.mtx.Unlock()
+  }
+}
+
+func (q *ringQueue) wake(cond *sync.Cond, waiting *int32) {
+  if atomic.LoadInt32(waiting) > 0 {
+    q.mtx.Lock()
+    cond.Signal()
+    q.mtx.Unlock()
+  }
+}
@@ -0,0 +1,100 @@
+/* Copyright (C) 2017-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestRingQueue(t *testing.T) {
+
+  q := newRingQueue(7)
+  n := 10000
+  m := 4
+  r := make([]int, m)
+  s := 0
+
+  wg := sync.WaitGroup{}
+  wg.Add(m)
+  for k := 0; k < m; k++ {
+    go func(k int) {
+      defer wg.Done()
+      for {
+        j, ok := q.pop(1)
+        if !ok {
+          return
+        }
+        r[k] += j.jobGroup
+      }
+    }(k)
+  }
+  for i := 1; i <= n; i++ {
+    if i % 2 == 0 {
+      q.push(job{jobGroup: i})
+    } else if q.tryPush(job{jobGroup: i}) != nil {
+      q.push(job{jobGroup: i})
+    }
+  }
+  q.close()
+  wg.Wait()
+  for k := 0; k < m; k++ {
+    s += r[k]
+  }
+  if s != n*(n+1)/2 {
+    t.Error("test failed")
+  }
+  if q.tryPush(job{}) != ErrStopped {
+    t.Error("test failed")
+  }
+}
+
+func TestLockFreeQueue(t *testing.T) {
+
+  p := New(5, 10, LockFreeQueue())
+  g := p.NewJobGroup()
+  r := make([]int, 1000)
+
+  if err := p.AddRangeJob_(0, len(r), g, func(iFrom, iTo int, p ThreadPool, erf func() error) error {
+    for i_ := iFrom; i_ < iTo; i_++ {
+      i := i_
+      p.AddJob(g, func(p ThreadPool, erf func() error) error {
+        r[i] = 1
+        return nil
+      })
+    }
+    return nil
+  }); err != nil {
+    t.Error(err)
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  for i := range r {
+    if r[i] != 1 {
+      t.Error("test failed")
+    }
+  }
+  p.Stop()
+}
@@ -0,0 +1,159 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync"
+import "sync/atomic"
+
+/* -------------------------------------------------------------------------- */
+
+// Number of blocks per thread into which a range is split for searching.
+// Blocks are dispatched in order, hence smaller blocks allow to skip more
+// of the range once a match is found
+const searchBlocks = 8
+
+// State of a parallel search. The result of the search is the match or
+// error at the lowest index, hence indices above this index are no longer
+// visited. If [any] is set, the first match or error found stops the search
+type searchState struct {
+  mtx   sync.Mutex
+  // indices below bound are visited, accessed atomically
+  bound int64
+  any   bool
+  // index of the match or error, -1 if none was found
+  index int
+  err   error
+}
+
+// True if index [i] must still be visited
+func (s *searchState) visit(i int) bool {
+  return int64(i) < atomic.LoadInt64(&s.bound)
+}
+
+func (s *searchState) set(i int, err error) {
+  s.mtx.Lock()
+  defer s.mtx.Unlock()
+  if int64(i) < s.bound {
+    s.index, s.err = i, err
+    if s.any {
+      atomic.StoreInt64(&s.bound, 0)
+    } else {
+      atomic.StoreInt64(&s.bound, int64(i))
+    }
+  }
+}
+
+// Visit [0,n) in blocks until [pred] is true or fails and return the index
+// at which this happened
+func (s *searchState) search(pool ThreadPool, n int, pred func(i int) (bool, error)) (int, error) {
+  s.bound = int64(n)
+  s.index = -1
+  if n <= 0 {
+    return -1, nil
+  }
+  m := searchBlocks*pool.NumberOfThreads()
+  if m > n {
+    m = n
+  }
+  fs := make([]func(pool ThreadPool, erf func() error) error, m)
+  for j := range fs {
+    iFrom := j*n/m
+    iTo   := (j+1)*n/m
+    fs[j] = func(pool ThreadPool, erf func() error) error {
+      for i := iFrom; i < iTo && s.visit(i); i++ {
+        if ok, err := pred(i); ok || err != nil {
+          s.set(i, err)
+        }
+      }
+      return nil
+    }
+  }
+  g := pool.NewJobGroup()
+  if err := pool.addJobs(g, fs); err != nil {
+    return -1, err
+  }
+  if err := pool.Wait(g); err != nil {
+    return -1, err
+  }
+  if s.err != nil {
+    return -1, s.err
+  }
+  return s.index, nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Search [0,n) in parallel and return the lowest index for which [pred]
+// is true, or -1 if there is none. Indices above a match are skipped. If
+// [pred] fails at an index below the first match, its error is returned
+func FindFirst(pool ThreadPool, n int, pred func(i int) (bool, error)) (int, error) {
+  s := searchState{}
+  return s.search(pool, n, pred)
+}
+
+// True if [pred] is true for any index in [0,n). The search stops at the
+// first match or error
+func Any(pool ThreadPool, n int, pred func(i int) (bool, error)) (bool, error) {
+  s := searchState{any: true}
+  i, err := s.search(pool, n, pred)
+  return i >= 0, err
+}
+
+// True if [pred] is true for all indices in [0,n). The search stops at
+// the first index for which [pred] is false or fails
+func All(pool ThreadPool, n int, pred func(i int) (bool, error)) (bool, error) {
+  s := searchState{any: true}
+  i, err := s.search(pool, n, func(i int) (bool, error) {
+    ok, err := pred(i)
+    return !ok, err
+  })
+  return i < 0 && err == nil, err
+}
+
+// Returns the number of indices in [0,n) for which [pred] is true. All
+// indices are visited unless [pred] fails
+func Count(pool ThreadPool, n int, pred func(i int) (bool, error)) (int, error) {
+  r   := int64(0)
+  err := pool.RangeJob_(0, n, func(iFrom, iTo int, pool ThreadPool, erf func() error) error {
+    c := int64(0)
+    for i := iFrom; i < iTo; i++ {
+      if err := erf(); err != nil {
+        return nil
+      }
+      ok, err := pred(i)
+      if err != nil {
+        return rangeError{i, err}
+      }
+      if ok {
+        c++
+      }
+    }
+    atomic.AddInt64(&r, c)
+    return nil
+  })
+  if err != nil {
+    return 0, err
+  }
+  return int(r), nil
+}
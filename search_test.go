@@ -0,0 +1,102 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "sync/atomic"
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestFindFirst(t *testing.T) {
+
+  for _, n := range []int{1, 3} {
+    p := New(n, 100)
+    c := int64(0)
+    i, err := FindFirst(p, 100000, func(i int) (bool, error) {
+      atomic.AddInt64(&c, 1)
+      return i % 1000 == 999, nil
+    })
+    if i != 999 || err != nil {
+      t.Errorf("test failed: %d %v", i, err)
+    }
+    // remaining blocks are skipped
+    if c >= 100000 {
+      t.Errorf("test failed: %d", c)
+    }
+    if i, err := FindFirst(p, 100, func(i int) (bool, error) { return false, nil }); i != -1 || err != nil {
+      t.Errorf("test failed: %d %v", i, err)
+    }
+    // error before the first match
+    e := errors.New("failed")
+    i, err = FindFirst(p, 100, func(i int) (bool, error) {
+      if i == 10 {
+        return false, e
+      }
+      return i == 20, nil
+    })
+    if i != -1 || err != e {
+      t.Errorf("test failed: %d %v", i, err)
+    }
+    p.Stop()
+  }
+}
+
+func TestAnyAllCount(t *testing.T) {
+
+  for _, n := range []int{1, 3} {
+    p := New(n, 100)
+    c := int64(0)
+    ok, err := Any(p, 100000, func(i int) (bool, error) {
+      atomic.AddInt64(&c, 1)
+      return i == 5000, nil
+    })
+    if !ok || err != nil {
+      t.Errorf("test failed: %v %v", ok, err)
+    }
+    if c >= 100000 {
+      t.Errorf("test failed: %d", c)
+    }
+    if ok, err := Any(p, 100, func(i int) (bool, error) { return false, nil }); ok || err != nil {
+      t.Errorf("test failed: %v %v", ok, err)
+    }
+    if ok, err := All(p, 100, func(i int) (bool, error) { return i < 100, nil }); !ok || err != nil {
+      t.Errorf("test failed: %v %v", ok, err)
+    }
+    if ok, err := All(p, 100, func(i int) (bool, error) { return i != 50, nil }); ok || err != nil {
+      t.Errorf("test failed: %v %v", ok, err)
+    }
+    if r, err := Count(p, 100, func(i int) (bool, error) { return i % 3 == 0, nil }); r != 34 || err != nil {
+      t.Errorf("test failed: %d %v", r, err)
+    }
+    e := errors.New("failed")
+    if _, err := Count(p, 100, func(i int) (bool, error) { return false, e }); !errors.Is(err, e) {
+      t.Errorf("test failed: %v", err)
+    }
+    if _, err := All(p, 100, func(i int) (bool, error) { return true, e }); err != e {
+      t.Errorf("test failed: %v", err)
+    }
+    p.Stop()
+  }
+}
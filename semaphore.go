@@ -0,0 +1,157 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "context"
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+// Weighted semaphore whose units are the workers of a pool, with the same
+// Acquire and Release methods as semaphore.Weighted of golang.org/x/sync.
+// Each acquired unit occupies an idle worker until it is released, hence
+// goroutines gated by the semaphore share the worker budget with the jobs
+// of the pool instead of adding to it
+type Semaphore struct {
+  pool    ThreadPool
+  size    int64
+  mtx     sync.Mutex
+  held    int64
+  release chan struct{}
+}
+
+// A single call of Acquire, whose units are occupied by the chunks of a
+// gang job
+type acquisition struct {
+  mtx     sync.Mutex
+  n       int
+  started int
+  done    int
+  aborted bool
+  granted chan struct{}
+  abort   chan struct{}
+}
+
+// Returns a semaphore with one unit for each worker of the pool. Pools
+// without workers, with a lock-free queue or with a single thread
+// have a semaphore of size zero
+func (t ThreadPool) Semaphore() *Semaphore {
+  s := Semaphore{pool: t, release: make(chan struct{})}
+  if t.NumberOfThreads() > 1 && t.hasWorkers() && !t.lockFree {
+    s.size = int64(t.NumberOfThreads()-1)
+    if t.sub != nil && s.size > int64(t.sub.limit) {
+      s.size = int64(t.sub.limit)
+    }
+  }
+  return &s
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Returns the number of units of the semaphore
+func (s *Semaphore) Size() int64 {
+  return s.size
+}
+
+// Acquire [n] units, blocking until [n] workers are idle at the same time
+// or [ctx] is done. On failure, ctx.Err() is returned and no units are
+// acquired. If [n] exceeds the size of the semaphore, Acquire blocks until
+// [ctx] is done
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+  if n <= 0 {
+    return nil
+  }
+  if n > s.size {
+    <- ctx.Done()
+    return ctx.Err()
+  }
+  a := acquisition{n: int(n), granted: make(chan struct{}), abort: make(chan struct{})}
+  g := s.pool.NewJobGroup()
+  if err := s.pool.AddGangJob(0, a.n, g, func(iFrom, iTo int, pool ThreadPool, erf func() error) error {
+    defer s.leave(&a, g)
+    a.mtx.Lock()
+    if a.aborted {
+      a.mtx.Unlock()
+      return nil
+    }
+    if a.started += 1; a.started == a.n {
+      close(a.granted)
+    }
+    a.mtx.Unlock()
+    // units are only released once all of them were granted
+    select {
+    case <- a.granted:
+    case <- a.abort:
+      return nil
+    }
+    <- s.release
+    return nil
+  }); err != nil {
+    s.pool.ClearJobGroup(g)
+    return err
+  }
+  select {
+  case <- a.granted:
+  case <- ctx.Done():
+    a.mtx.Lock()
+    if a.started < a.n {
+      a.aborted = true
+      close(a.abort)
+      a.mtx.Unlock()
+      return ctx.Err()
+    }
+    a.mtx.Unlock()
+  }
+  s.mtx.Lock()
+  s.held += n
+  s.mtx.Unlock()
+  return nil
+}
+
+// Called when a unit of [a] is returned to the pool. The job group of
+// the acquisition is released by the last unit
+func (s *Semaphore) leave(a *acquisition, jobGroup int) {
+  a.mtx.Lock()
+  a.done += 1
+  last := a.done == a.n
+  a.mtx.Unlock()
+  if last {
+    s.pool.ClearJobGroup(jobGroup)
+  }
+}
+
+// Release [n] units, which returns the workers to the pool. Panics if
+// more units are released than held
+func (s *Semaphore) Release(n int64) {
+  s.mtx.Lock()
+  if n > s.held {
+    s.mtx.Unlock()
+    panic("threadpool: semaphore released more than held")
+  }
+  s.held -= n
+  s.mtx.Unlock()
+  for i := int64(0); i < n; i++ {
+    s.release <- struct{}{}
+  }
+}
@@ -0,0 +1,70 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "context"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestSemaphore(t *testing.T) {
+
+  p := New(4, 100)
+  defer p.Stop()
+
+  s := p.Semaphore()
+  if s.Size() != 3 {
+    t.Errorf("test failed: %d", s.Size())
+  }
+  if err := s.Acquire(context.Background(), 2); err != nil {
+    t.Error(err)
+  }
+  if err := s.Acquire(context.Background(), 1); err != nil {
+    t.Error(err)
+  }
+  // all workers are occupied
+  ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+  defer cancel()
+  if err := s.Acquire(ctx, 1); err != context.DeadlineExceeded {
+    t.Errorf("test failed: %v", err)
+  }
+  s.Release(3)
+  // the aborted acquisition does not hold a worker
+  if err := s.Acquire(context.Background(), 3); err != nil {
+    t.Error(err)
+  }
+  s.Release(3)
+  func() {
+    defer func() {
+      if recover() == nil {
+        t.Error("test failed")
+      }
+    }()
+    s.Release(1)
+  }()
+  if New(1, 100).Semaphore().Size() != 0 {
+    t.Error("test failed")
+  }
+}
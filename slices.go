@@ -0,0 +1,141 @@
+//go:build go1.18
+// +build go1.18
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+// True if [pred] is true for any element of [s]. The search stops at the
+// first match (requires Go 1.18)
+func AnySlice[T any](pool ThreadPool, s []T, pred func(x T) bool) (bool, error) {
+  return Any(pool, len(s), func(i int) (bool, error) {
+    return pred(s[i]), nil
+  })
+}
+
+// True if [pred] is true for all elements of [s]. The search stops at
+// the first element for which [pred] is false (requires Go 1.18)
+func AllSlice[T any](pool ThreadPool, s []T, pred func(x T) bool) (bool, error) {
+  return All(pool, len(s), func(i int) (bool, error) {
+    return pred(s[i]), nil
+  })
+}
+
+// Returns the number of elements of [s] for which [pred] is true
+// (requires Go 1.18)
+func CountSlice[T any](pool ThreadPool, s []T, pred func(x T) bool) (int, error) {
+  return Count(pool, len(s), func(i int) (bool, error) {
+    return pred(s[i]), nil
+  })
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Numeric types supported by Sum, Min and Max
+type Number interface {
+  ~int | ~int8 | ~int16 | ~int32 | ~int64 |
+  ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+  ~float32 | ~float64
+}
+
+// Number of elements of the chunks that are reduced by a single job. The
+// chunks do not depend on the number of threads, hence floating point
+// results are the same for all pools
+const reduceChunk = 4096
+
+// Reduce each chunk of [s] with [f] and merge the partial results in the
+// order of the chunks with [merge]
+func reduce[T any](pool ThreadPool, s []T, f func(s []T) T, merge func(a, b T) T) (T, error) {
+  var r T
+  if len(s) == 0 {
+    return r, nil
+  }
+  partials := make([]T, (len(s)+reduceChunk-1)/reduceChunk)
+  err := pool.RangeJob(0, len(partials), func(j int, pool ThreadPool, erf func() error) error {
+    iFrom := j*reduceChunk
+    iTo   := iFrom+reduceChunk
+    if iTo > len(s) {
+      iTo = len(s)
+    }
+    partials[j] = f(s[iFrom:iTo])
+    return nil
+  })
+  if err != nil {
+    return r, err
+  }
+  r = partials[0]
+  for _, p := range partials[1:] {
+    r = merge(r, p)
+  }
+  return r, nil
+}
+
+// Returns the sum of [s]. Partial sums of chunks are added in a fixed
+// order, hence the result does not depend on the number of threads
+// (requires Go 1.18)
+func Sum[T Number](pool ThreadPool, s []T) (T, error) {
+  return reduce(pool, s, func(s []T) T {
+    r := T(0)
+    for _, x := range s {
+      r += x
+    }
+    return r
+  }, func(a, b T) T {
+    return a+b
+  })
+}
+
+// Returns the minimum of [s] or zero if [s] is empty (requires Go 1.18)
+func Min[T Number](pool ThreadPool, s []T) (T, error) {
+  less := func(a, b T) T {
+    if b < a {
+      return b
+    }
+    return a
+  }
+  return reduce(pool, s, func(s []T) T {
+    r := s[0]
+    for _, x := range s[1:] {
+      r = less(r, x)
+    }
+    return r
+  }, less)
+}
+
+// Returns the maximum of [s] or zero if [s] is empty (requires Go 1.18)
+func Max[T Number](pool ThreadPool, s []T) (T, error) {
+  greater := func(a, b T) T {
+    if b > a {
+      return b
+    }
+    return a
+  }
+  return reduce(pool, s, func(s []T) T {
+    r := s[0]
+    for _, x := range s[1:] {
+      r = greater(r, x)
+    }
+    return r
+  }, greater)
+}
@@ -0,0 +1,84 @@
+//go:build go1.18
+// +build go1.18
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestSlicePredicates(t *testing.T) {
+
+  p := New(3, 100)
+  defer p.Stop()
+
+  s := []string{"a", "bb", "ccc", "dddd"}
+  if ok, err := AnySlice(p, s, func(x string) bool { return len(x) == 3 }); !ok || err != nil {
+    t.Errorf("test failed: %v %v", ok, err)
+  }
+  if ok, err := AllSlice(p, s, func(x string) bool { return len(x) < 4 }); ok || err != nil {
+    t.Errorf("test failed: %v %v", ok, err)
+  }
+  if r, err := CountSlice(p, s, func(x string) bool { return len(x) % 2 == 0 }); r != 2 || err != nil {
+    t.Errorf("test failed: %d %v", r, err)
+  }
+}
+
+func TestSumMinMax(t *testing.T) {
+
+  s := make([]float64, 100000)
+  for i := range s {
+    s[i] = 1.0/float64(i+1)
+  }
+  s[500] = -1.0
+  s[90000] = 2.0
+
+  r := []float64{}
+  for _, n := range []int{1, 2, 3, 7} {
+    p := New(n, 100)
+    x, err := Sum(p, s)
+    if err != nil {
+      t.Error(err)
+    }
+    r = append(r, x)
+    if x, err := Min(p, s); x != -1.0 || err != nil {
+      t.Errorf("test failed: %v %v", x, err)
+    }
+    if x, err := Max(p, s); x != 2.0 || err != nil {
+      t.Errorf("test failed: %v %v", x, err)
+    }
+    if x, err := Sum(p, []int{}); x != 0 || err != nil {
+      t.Errorf("test failed: %v %v", x, err)
+    }
+    p.Stop()
+  }
+  // results are reproducible for all numbers of threads
+  for i := range r {
+    if r[i] != r[0] {
+      t.Errorf("test failed: %v", r)
+    }
+  }
+}
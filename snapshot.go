@@ -0,0 +1,126 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sort"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// State of the pool at a point in time, which can be serialized as JSON
+type Snapshot struct {
+  // name of the pool (see Name)
+  Name     string           `json:"name"`
+  Time     time.Time        `json:"time"`
+  Threads  []ThreadSnapshot `json:"threads"`
+  // number of queued jobs and size of the queue
+  Queue    int              `json:"queue"`
+  Capacity int              `json:"capacity"`
+  Stopped  bool             `json:"stopped"`
+  Groups   []GroupSnapshot  `json:"groups"`
+}
+
+type ThreadSnapshot struct {
+  Id       int       `json:"id"`
+  Running  bool      `json:"running"`
+  // group and start time of the running job
+  JobGroup int       `json:"group"`
+  Since    time.Time `json:"since"`
+}
+
+type GroupSnapshot struct {
+  JobGroup  int       `json:"group"`
+  Pending   int       `json:"pending"`
+  Error     string    `json:"error,omitempty"`
+  Created   time.Time `json:"created"`
+  // group of the job that first submitted jobs to this group
+  Parent    int       `json:"parent"`
+  HasParent bool      `json:"has_parent"`
+  Metadata  Metadata  `json:"metadata,omitempty"`
+}
+
+/* -------------------------------------------------------------------------- */
+
+func (t *threadPool) threadSnapshot(i int) ThreadSnapshot {
+  r := ThreadSnapshot{Id: i}
+  r.JobGroup, r.Since, r.Running = t.activity[i].get()
+  return r
+}
+
+// Call the heartbeat hook for all threads until [q] is closed
+func (t *threadPool) monitor(q jobQueue) {
+  ticker := time.NewTicker(t.heartbeat)
+  defer ticker.Stop()
+  for range ticker.C {
+    if q.isClosed() {
+      return
+    }
+    for i := range t.activity {
+      t.heartbeatHook(t.threadSnapshot(i))
+    }
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Returns the current state of the pool. Threads, queue and groups are
+// not captured atomically, hence the snapshot may be slightly inconsistent
+// while jobs are executed
+func (t ThreadPool) Snapshot() Snapshot {
+  r := Snapshot{Time: time.Now()}
+  if t.threadPool == nil {
+    r.Threads = []ThreadSnapshot{{Id: 0}}
+    r.Groups  = []GroupSnapshot{}
+    return r
+  }
+  r.Name    = t.name
+  r.Threads = make([]ThreadSnapshot, len(t.activity))
+  for i := range t.activity {
+    r.Threads[i] = t.threadSnapshot(i)
+  }
+  if t.queue != nil {
+    r.Queue   = t.queue.length()
+    r.Stopped = t.queue.isClosed()
+  } else {
+    r.Stopped = true
+  }
+  r.Capacity = t.bufferSize()
+  r.Groups   = []GroupSnapshot{}
+  for i := range t.groups {
+    shard := &t.groups[i]
+    shard.mtx.RLock()
+    for jobGroup, state := range shard.m {
+      g := GroupSnapshot{JobGroup: jobGroup, Pending: state.wg.Value(), Created: state.created}
+      g.Parent, g.HasParent = state.getParent()
+      g.Metadata = state.getMetadata()
+      if err := state.getError(); err != nil {
+        g.Error = err.Error()
+      }
+      r.Groups = append(r.Groups, g)
+    }
+    shard.mtx.RUnlock()
+  }
+  sort.Slice(r.Groups, func(i, j int) bool { return r.Groups[i].JobGroup < r.Groups[j].JobGroup })
+  return r
+}
@@ -0,0 +1,90 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "encoding/json"
+import "fmt"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestSnapshot(t *testing.T) {
+
+  p := New(3, 100, Manual())
+  g := p.NewJobGroup()
+
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    return fmt.Errorf("test error")
+  })
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    return nil
+  })
+  p.Step()
+
+  s := p.Snapshot()
+  if len(s.Threads) != 3 || s.Queue != 1 || s.Capacity != 100 || s.Stopped {
+    t.Errorf("test failed: %+v", s)
+  }
+  if len(s.Groups) != 1 || s.Groups[0].Pending != 1 || s.Groups[0].Error != "test error" {
+    t.Errorf("test failed: %+v", s)
+  }
+  if _, err := json.Marshal(s); err != nil {
+    t.Error(err)
+  }
+  p.Wait(g)
+
+  if s := Nil().Snapshot(); len(s.Threads) != 1 {
+    t.Errorf("test failed: %+v", s)
+  }
+}
+
+func TestHeartbeat(t *testing.T) {
+
+  r := make(chan ThreadSnapshot, 100)
+  p := New(2, 100, Heartbeat(time.Millisecond, func(s ThreadSnapshot) {
+    select {
+    case r <- s:
+    default:
+    }
+  }))
+  g := p.NewJobGroup()
+
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    time.Sleep(20*time.Millisecond)
+    return nil
+  })
+  p.Wait(g)
+  p.Stop()
+
+  running := false
+  for len(r) > 0 {
+    if s := <- r; s.Running && s.JobGroup == g {
+      running = true
+    }
+  }
+  if !running {
+    t.Error("test failed")
+  }
+}
@@ -0,0 +1,141 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync/atomic"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Statistics of the pool
+type Stats struct {
+  // time since the pool was started
+  Uptime      time.Duration     `json:"uptime"`
+  // time each thread spent executing jobs since the pool was started
+  Busy        []time.Duration   `json:"busy"`
+  // fraction of the uptime each thread spent executing jobs
+  Utilization []float64         `json:"utilization"`
+  // histograms of job execution times indexed by job group, only
+  // recorded with the Histograms option
+  Histograms  map[int]Histogram `json:"histograms"`
+  // number of workers that were terminated by a job and replaced
+  Respawns    int64             `json:"respawns"`
+  // number of jobs executed by the submitting thread because the
+  // queue was full
+  Inline      int64             `json:"inline"`
+}
+
+func (t ThreadPool) Stats() Stats {
+  r := Stats{Histograms: map[int]Histogram{}}
+  if t.threadPool == nil {
+    return r
+  }
+  now := time.Now()
+  r.Respawns    = atomic.LoadInt64(&t.respawns)
+  r.Inline      = atomic.LoadInt64(&t.inline)
+  r.Uptime      = now.Sub(time.Unix(0, atomic.LoadInt64(&t.started)))
+  r.Busy        = make([]time.Duration, len(t.activity))
+  r.Utilization = make([]float64, len(t.activity))
+  for i := range t.activity {
+    r.Busy[i] = time.Duration(atomic.LoadInt64(&t.activity[i].busy))
+    // include the running job
+    if _, start, ok := t.activity[i].get(); ok {
+      r.Busy[i] += now.Sub(start)
+    }
+    if r.Uptime > 0 {
+      r.Utilization[i] = float64(r.Busy[i])/float64(r.Uptime)
+    }
+  }
+  if t.histograms == nil {
+    return r
+  }
+  t.histograms.mtx.Lock()
+  defer t.histograms.mtx.Unlock()
+  for jobGroup, h := range t.histograms.m {
+    r.Histograms[jobGroup] = h.get()
+  }
+  return r
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Threads that execute jobs
+const (
+  // worker of the pool
+  byWorker = iota
+  // thread that waits for a job group in Wait or calls Step
+  byWaiter
+  // thread that submits a job while the queue is full
+  bySubmitter
+)
+
+// Summary of the executed jobs of a job group
+type GroupStats struct {
+  // number of executed jobs
+  Jobs    int64         `json:"jobs"`
+  // total and maximum execution time of jobs
+  Total   time.Duration `json:"total"`
+  Max     time.Duration `json:"max"`
+  // number of jobs executed by threads that were waiting for a
+  // job group
+  Waiting int64         `json:"waiting"`
+  // number of jobs executed at submission because the queue was full
+  Inline  int64         `json:"inline"`
+}
+
+// Counters of executed jobs, accessed atomically
+type groupStats struct {
+  jobs    int64
+  total   int64
+  max     int64
+  waiting int64
+  inline  int64
+}
+
+func (obj *groupStats) observe(d time.Duration, by int) {
+  atomic.AddInt64(&obj.jobs, 1)
+  atomic.AddInt64(&obj.total, int64(d))
+  for {
+    max := atomic.LoadInt64(&obj.max)
+    if int64(d) <= max || atomic.CompareAndSwapInt64(&obj.max, max, int64(d)) {
+      break
+    }
+  }
+  switch by {
+  case byWaiter:
+    atomic.AddInt64(&obj.waiting, 1)
+  case bySubmitter:
+    atomic.AddInt64(&obj.inline, 1)
+  }
+}
+
+func (obj *groupStats) get() GroupStats {
+  r := GroupStats{}
+  r.Jobs    = atomic.LoadInt64(&obj.jobs)
+  r.Total   = time.Duration(atomic.LoadInt64(&obj.total))
+  r.Max     = time.Duration(atomic.LoadInt64(&obj.max))
+  r.Waiting = atomic.LoadInt64(&obj.waiting)
+  r.Inline  = atomic.LoadInt64(&obj.inline)
+  return r
+}
@@ -0,0 +1,134 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "runtime"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestUtilization(t *testing.T) {
+
+  p := New(2, 100)
+  g := p.NewJobGroup()
+
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    time.Sleep(20*time.Millisecond)
+    return nil
+  })
+  p.Wait(g)
+  time.Sleep(20*time.Millisecond)
+
+  s := p.Stats()
+  if len(s.Utilization) != 2 || s.Utilization[0] + s.Utilization[1] <= 0.0 || s.Utilization[0] + s.Utilization[1] >= 1.0 {
+    t.Errorf("test failed: %+v", s)
+  }
+  if s.Busy[0] + s.Busy[1] < 20*time.Millisecond {
+    t.Errorf("test failed: %+v", s)
+  }
+}
+
+func TestRespawn(t *testing.T) {
+
+  p := New(2, 100)
+  g := p.NewJobGroup()
+
+  // terminate the only worker
+  done := make(chan struct{})
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    defer close(done)
+    runtime.Goexit()
+    return nil
+  })
+  <- done
+  p.Wait(g)
+
+  // a replacement must execute further jobs
+  done = make(chan struct{})
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    close(done)
+    return nil
+  })
+  select {
+  case <- done:
+  case <- time.After(time.Second):
+    t.Error("worker was not replaced")
+  }
+  p.Wait(g)
+  if p.Stats().Respawns != 1 {
+    t.Error("test failed")
+  }
+}
+
+func TestWaitStats(t *testing.T) {
+
+  p := New(2, 2, Manual())
+  g := p.NewJobGroup()
+
+  // two jobs are queued and executed by Wait, the remaining
+  // jobs are executed at submission
+  for i := 0; i < 4; i++ {
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      time.Sleep(time.Millisecond)
+      return nil
+    })
+  }
+  s, err := p.WaitStats(g)
+  if err != nil {
+    t.Error(err)
+  }
+  if s.Jobs != 4 || s.Waiting != 2 || s.Inline != 2 {
+    t.Errorf("test failed: %+v", s)
+  }
+  if s.Max < time.Millisecond || s.Total < 4*time.Millisecond || s.Total < s.Max {
+    t.Errorf("test failed: %+v", s)
+  }
+}
+
+func TestSaturationWarning(t *testing.T) {
+
+  r := []int64{}
+  p := New(2, 2, Manual(), SaturationWarning(time.Hour, func(n int64) {
+    r = append(r, n)
+  }))
+  g := p.NewJobGroup()
+
+  // the last two jobs are executed at submission
+  for i := 0; i < 4; i++ {
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      return nil
+    })
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  if n := p.Stats().Inline; n != 2 {
+    t.Errorf("test failed: %d", n)
+  }
+  // the hook is called at most once per hour
+  if len(r) != 1 || r[0] != 1 {
+    t.Errorf("test failed: %v", r)
+  }
+}
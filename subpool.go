@@ -0,0 +1,145 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+// Limits the number of jobs of a sub-pool that are queued or executed at
+// the same time. Further jobs are kept back until a job of the sub-pool
+// is done
+type subPool struct {
+  mtx     sync.Mutex
+  // handle of the parent pool
+  pool    ThreadPool
+  limit   int
+  active  int
+  pending []job
+  // sub-pool was returned by Nested
+  nested  bool
+}
+
+func (s *subPool) submit(j job) error {
+  f := j.f
+  j.f = func(pool ThreadPool, erf func() error) error {
+    // nested jobs are submitted to the sub-pool
+    pool.sub  = s
+    pool.held = s
+    return f(pool, erf)
+  }
+  finish := j.finish
+  j.finish = func() {
+    s.next()
+    if finish != nil {
+      finish()
+    }
+  }
+  s.mtx.Lock()
+  if s.active >= s.limit {
+    s.pending = append(s.pending, j)
+    s.mtx.Unlock()
+    return nil
+  }
+  s.active += 1
+  s.mtx.Unlock()
+  return s.pool.submit(j)
+}
+
+// Called when a job of the sub-pool is done, dispatches the next
+// pending job
+func (s *subPool) next() {
+  s.mtx.Lock()
+  if len(s.pending) == 0 {
+    s.active -= 1
+    s.mtx.Unlock()
+    return
+  }
+  j := s.pending[0]
+  s.pending[0] = job{}
+  s.pending    = s.pending[1:]
+  s.mtx.Unlock()
+  // if the job cannot be submitted, it is finished
+  // immediately, which dispatches the next job
+  s.pool.submit(j)
+}
+
+// Called when a job of the sub-pool blocks in Wait, the job no longer
+// counts against the limit so that pending jobs, which might be waited
+// for, can be dispatched
+func (s *subPool) block() {
+  s.next()
+}
+
+// Called when a job of the sub-pool returns from Wait
+func (s *subPool) unblock() {
+  s.mtx.Lock()
+  s.active += 1
+  s.mtx.Unlock()
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Returns a view of the pool that executes at most [n] of its jobs at the
+// same time on the workers of the pool. Jobs submitted from within these
+// jobs are subject to the same limit. A library can be handed a sub-pool
+// without being able to starve the remaining users of the pool. Gang jobs
+// submitted to a sub-pool have at most [n] chunks. Jobs that are blocked
+// in Wait do not count against the limit. NumberOfThreads and GetThreadId
+// are the same as for the parent pool
+func (t ThreadPool) SubPool(n int) ThreadPool {
+  if n < 1 {
+    panic("invalid number of threads")
+  }
+  if t.NumberOfThreads() == 1 {
+    return t
+  }
+  r := t
+  r.sub = &subPool{pool: t, limit: n}
+  return r
+}
+
+// Returns one sub-pool per weight, which share the workers of the pool. Each
+// sub-pool executes at most a share of NumberOfThreads() jobs at the same
+// time that is proportional to its weight, but at least one job. Independent
+// components can be given their own sub-pool instead of creating separate
+// pools that oversubscribe the CPU
+func (t ThreadPool) Share(weights ...int) []ThreadPool {
+  sum := 0
+  for _, w := range weights {
+    if w < 1 {
+      panic("invalid weight")
+    }
+    sum += w
+  }
+  r := make([]ThreadPool, len(weights))
+  for i, w := range weights {
+    n := t.NumberOfThreads()*w/sum
+    if n < 1 {
+      n = 1
+    }
+    r[i] = t.SubPool(n)
+  }
+  return r
+}
@@ -0,0 +1,165 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "fmt"
+import "sync/atomic"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestSubPool(t *testing.T) {
+
+  p := New(5, 100)
+  s := p.SubPool(2)
+  g := s.NewJobGroup()
+
+  active := int32(0)
+  f := func(pool ThreadPool, erf func() error) error {
+    defer atomic.AddInt32(&active, -1)
+    if atomic.AddInt32(&active, 1) > 2 {
+      return fmt.Errorf("limit of sub-pool exceeded")
+    }
+    time.Sleep(time.Millisecond)
+    return nil
+  }
+  for i := 0; i < 20; i++ {
+    s.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      // nested jobs are subject to the same limit
+      pool.AddJob(g, f)
+      return f(pool, erf)
+    })
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  if err := s.RangeJob(0, 100, func(i int, pool ThreadPool, erf func() error) error {
+    return nil
+  }); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestSubPoolCancel(t *testing.T) {
+
+  p := New(5, 100, CancelOnError())
+  s := p.SubPool(1)
+  g := s.NewJobGroup()
+
+  for i := 0; i < 20; i++ {
+    s.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      return fmt.Errorf("test error")
+    })
+  }
+  // pending jobs must not block Wait
+  if err := s.Wait(g); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestSubPoolNestedWait(t *testing.T) {
+
+  p := New(5, 100)
+  s := p.SubPool(1)
+  g := s.NewJobGroup()
+
+  for i := 0; i < 4; i++ {
+    s.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      // the nested job is kept back by the sub-pool until
+      // this job waits for it
+      h := pool.NewJobGroup()
+      pool.AddJob(h, func(pool ThreadPool, erf func() error) error {
+        time.Sleep(time.Millisecond)
+        return nil
+      })
+      return pool.Wait(h)
+    })
+  }
+  done := make(chan error, 1)
+  go func() {
+    done <- s.Wait(g)
+  }()
+  select {
+  case err := <-done:
+    if err != nil {
+      t.Error(err)
+    }
+  case <-time.After(5 * time.Second):
+    t.Fatal("deadlock")
+  }
+}
+
+func TestSubPoolWithinJob(t *testing.T) {
+
+  p := New(5, 100)
+  g := p.NewJobGroup()
+
+  active := int32(0)
+  peak   := int32(0)
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    // the waiting job does not hold a slot of the sub-pool
+    s := pool.SubPool(1)
+    h := s.NewJobGroup()
+    for i := 0; i < 10; i++ {
+      s.AddJob(h, func(pool ThreadPool, erf func() error) error {
+        defer atomic.AddInt32(&active, -1)
+        if n := atomic.AddInt32(&active, 1); n > atomic.LoadInt32(&peak) {
+          atomic.StoreInt32(&peak, n)
+        }
+        time.Sleep(time.Millisecond)
+        return nil
+      })
+    }
+    return s.Wait(h)
+  })
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  if peak != 1 {
+    t.Errorf("test failed: %d", peak)
+  }
+}
+
+func TestShare(t *testing.T) {
+
+  p := New(8, 100)
+  r := p.Share(1, 3, 4, 100)
+
+  for i, n := range []int{1, 1, 1, 7} {
+    if r[i].sub.limit != n {
+      t.Errorf("test failed: %d", r[i].sub.limit)
+    }
+  }
+  for i := range r {
+    if err := r[i].RangeJob(0, 100, func(i int, pool ThreadPool, erf func() error) error {
+      return nil
+    }); err != nil {
+      t.Error(err)
+    }
+  }
+  if r := Nil().Share(1, 2); len(r) != 2 || r[0].NumberOfThreads() != 1 {
+    t.Error("test failed")
+  }
+}
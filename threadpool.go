@@ -23,68 +23,428 @@ package threadpool
 
 /* -------------------------------------------------------------------------- */
 
-//import "fmt"
+import "context"
+import "errors"
+import "fmt"
+import "hash/fnv"
+import "log"
+import "math/rand"
+import "os"
+import "runtime"
+import "runtime/debug"
+import "runtime/pprof"
+import "sort"
+import "strconv"
 import "sync"
+import "sync/atomic"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Job that exceeded the threshold of the SlowJobs option
+type SlowJob struct {
+  JobGroup int
+  ThreadId int
+  Start    time.Time
+  Duration time.Duration
+  // error returned by the job
+  Err      error
+  Metadata Metadata
+}
+
+func (obj SlowJob) String() string {
+  return fmt.Sprintf("slow job of group %d on thread %d took %v", obj.JobGroup, obj.ThreadId, obj.Duration)
+}
 
 /* -------------------------------------------------------------------------- */
 
 type job struct {
   f func(ThreadPool, func() error) error
   jobGroup int
+  // state of the job group, which is resolved at submission
+  group *jobGroupState
+  // number of dequeued jobs at the time this job was queued
+  seq    uint64
+  // metadata attached at submission
+  meta   Metadata
+  // position in submission order within the job group
+  index  int
+  // chunks of a gang job, which are dispatched together
+  gang   []job
+  // job is a chunk of a gang job
+  member bool
+  // called once the job is done or dropped
+  finish func()
+  // jobs with higher priority are dispatched first within
+  // their group
+  priority int
+  // if non-zero, the job is never executed at submission but
+  // submission waits at most this long for space in the queue
+  timeout  time.Duration
+  // if non-zero, the job is only executed by this worker
+  worker   int
+  // limit of the key of the job, which is applied at submission
+  limit    *keyLimit
 }
 
 /* -------------------------------------------------------------------------- */
 
+// Counts the number of pending jobs of a job group. The counter is
+// updated atomically, the mutex is only required when the counter
+// drops to or rises from zero
 type waitGroup struct {
-  wg    *sync.WaitGroup
-  mutex *sync.RWMutex
-  cnt    int
+  cnt    int64
+  mutex  sync.Mutex
+  // closed when the counter drops to zero
+  done   chan struct{}
+  closed bool
 }
 
 func newWaitGroup() *waitGroup {
   r := waitGroup{}
-  r.wg    = new(sync.WaitGroup)
-  r.mutex = new(sync.RWMutex)
-  r.cnt   = 0
+  r.done = make(chan struct{})
   return &r
 }
 
 func (obj *waitGroup) Value() int {
-  obj.mutex.RLock()
-  defer obj.mutex.RUnlock()
-  return obj.cnt
+  return int(atomic.LoadInt64(&obj.cnt))
 }
 
 func (obj *waitGroup) Add(i int) {
-  obj.mutex.Lock()
-  obj.cnt += i
-  obj.wg.Add(i)
-  obj.mutex.Unlock()
+  n := atomic.AddInt64(&obj.cnt, int64(i))
+  switch {
+  case n < 0:
+    panic("negative wait group counter")
+  case n == 0:
+    obj.mutex.Lock()
+    if atomic.LoadInt64(&obj.cnt) == 0 && !obj.closed {
+      close(obj.done)
+      obj.closed = true
+    }
+    obj.mutex.Unlock()
+  case n == int64(i):
+    // counter was zero
+    obj.mutex.Lock()
+    if obj.closed {
+      obj.done   = make(chan struct{})
+      obj.closed = false
+    }
+    obj.mutex.Unlock()
+  }
 }
 
 func (obj *waitGroup) Done() {
+  obj.Add(-1)
+}
+
+// Returns a channel that is closed once the counter drops to zero
+func (obj *waitGroup) Channel() <-chan struct{} {
   obj.mutex.Lock()
-  obj.cnt -= 1
-  obj.wg.Done()
-  obj.mutex.Unlock()
+  defer obj.mutex.Unlock()
+  if atomic.LoadInt64(&obj.cnt) == 0 {
+    return closedChannel
+  }
+  return obj.done
 }
 
 func (obj *waitGroup) Wait() {
-  obj.wg.Wait()
+  for obj.Value() > 0 {
+    <- obj.Channel()
+  }
+}
+
+var closedChannel = func() chan struct{} {
+  c := make(chan struct{})
+  close(c)
+  return c
+}()
+
+/* -------------------------------------------------------------------------- */
+
+// State of a job group
+type jobGroupState struct {
+  wg     *waitGroup
+  errmtx  sync.RWMutex
+  err     error
+  // time at which a job of this group was last dequeued, only
+  // accessed by the queue
+  served  uint64
+  // barrier for the chunks of gang jobs
+  barrier barrier
+  // deadline in nanoseconds since the epoch, zero if not set
+  deadline int64
+  created  time.Time
+  // group of the job that first submitted jobs to this group,
+  // protected by errmtx
+  parent    int
+  hasParent int32
+  // number of submitted jobs
+  submitted int64
+  // execution times of jobs, nil if disabled
+  hist      *histogram
+  // summary of executed jobs
+  stats     groupStats
+  // error probe passed to jobs, which is created once per group
+  // so that executing a job does not allocate
+  erf       func() error
+  // slots of outstanding jobs, nil if the number of jobs is not
+  // limited
+  quota     chan struct{}
+  // metadata and name of the group, protected by errmtx
+  meta      Metadata
+  name      string
+  // context of the group, which is cancelled as soon as an error is
+  // recorded, protected by errmtx
+  ctx       context.Context
+  ctxCancel context.CancelFunc
+  // number of executed or dropped jobs
+  finished  int64
+  // set once the group was cancelled by CancelJobGroup
+  cancelled int32
+  // parent and children of groups created with NewChildJobGroup,
+  // protected by errmtx
+  up        *jobGroupState
+  children  []*jobGroupState
+  // progress callbacks, protected by errmtx, observed is set
+  // once a callback is registered, after which jobs finish
+  // one at a time
+  observed  int32
+  observers []*progressObserver
+  progmtx   sync.Mutex
+}
+
+func newJobGroupState() *jobGroupState {
+  r := jobGroupState{}
+  r.init(newWaitGroup())
+  return &r
+}
+
+func (obj *jobGroupState) init(wg *waitGroup) {
+  obj.wg      = wg
+  obj.created = time.Now()
+  obj.erf     = obj.getError
+}
+
+func (obj *jobGroupState) getParent() (int, bool) {
+  obj.errmtx.RLock()
+  defer obj.errmtx.RUnlock()
+  return obj.parent, obj.hasParent != 0
+}
+
+func (obj *jobGroupState) setParent(parent int) {
+  if atomic.LoadInt32(&obj.hasParent) != 0 {
+    return
+  }
+  obj.errmtx.Lock()
+  if obj.hasParent == 0 {
+    obj.parent = parent
+    atomic.StoreInt32(&obj.hasParent, 1)
+  }
+  obj.errmtx.Unlock()
+}
+
+// Reserve submission indices for [n] jobs and return the first
+func (obj *jobGroupState) nextIndex(n int) int {
+  return int(atomic.AddInt64(&obj.submitted, int64(n))) - n
+}
+
+func (obj *jobGroupState) getError() error {
+  obj.errmtx.RLock()
+  defer obj.errmtx.RUnlock()
+  return obj.err
+}
+
+func (obj *jobGroupState) setError(err error) {
+  obj.errmtx.Lock()
+  if obj.ctx != nil {
+    if err != nil {
+      obj.ctxCancel()
+    } else if obj.err != nil {
+      // context was cancelled by the previous error
+      obj.ctx, obj.ctxCancel = nil, nil
+    }
+  }
+  obj.err = err
+  obj.errmtx.Unlock()
+}
+
+// Record [err] unless an error was recorded before
+func (obj *jobGroupState) setErrorIfNil(err error) {
+  obj.errmtx.Lock()
+  defer obj.errmtx.Unlock()
+  if obj.err == nil {
+    obj.err = err
+    if obj.ctx != nil {
+      obj.ctxCancel()
+    }
+  }
+}
+
+// Returns the context of the group, which is created on first use
+func (obj *jobGroupState) getContext() context.Context {
+  obj.errmtx.Lock()
+  defer obj.errmtx.Unlock()
+  if obj.ctx == nil {
+    obj.ctx, obj.ctxCancel = context.WithCancel(context.Background())
+    if obj.err != nil {
+      obj.ctxCancel()
+    }
+  }
+  return obj.ctx
+}
+
+// Release the context of the group
+func (obj *jobGroupState) release() {
+  obj.errmtx.Lock()
+  if obj.ctx != nil {
+    obj.ctxCancel()
+  }
+  obj.errmtx.Unlock()
+  if atomic.LoadInt32(&obj.observed) != 0 {
+    obj.releaseObservers()
+  }
+  obj.unlink()
+}
+
+// Error probe of jobs that are executed immediately
+func noError() error {
+  return nil
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Job group states are distributed over several maps, each protected by
+// its own mutex, to reduce lock contention
+const jobGroupShards = 32
+
+// Largest job group id returned by NewJobGroup
+const maxJobGroup = int(^uint(0) >> 1)
+
+type jobGroupShard struct {
+  mtx  sync.RWMutex
+  m    map[int]*jobGroupState
+  // states of new groups that are allocated in batches (see
+  // ExpectedGroups)
+  slab []jobGroupSlot
+  size int
+}
+
+// State of a job group together with its wait group, such that both are
+// allocated at once
+type jobGroupSlot struct {
+  state jobGroupState
+  wg    waitGroup
+}
+
+// Returns the state of a new group, which is taken from the current batch
+// if states are allocated in batches. Must be called with the lock held
+func (shard *jobGroupShard) newJobGroupState() *jobGroupState {
+  if shard.size == 0 {
+    return newJobGroupState()
+  }
+  if len(shard.slab) == 0 {
+    shard.slab = make([]jobGroupSlot, shard.size)
+  }
+  r := &shard.slab[0]
+  shard.slab = shard.slab[1:]
+  r.wg.done = make(chan struct{})
+  r.state.init(&r.wg)
+  return &r.state
 }
 
 /* -------------------------------------------------------------------------- */
 
 type threadPool struct {
   threads  int
-  bufsize  int
-  channel  chan job
-  cntmtx  *sync.RWMutex
-  cnt      int
-  wgmmtx  *sync.RWMutex
-  wgm      map[int]*waitGroup
-  errmtx  *sync.RWMutex
-  err      map[int]error
+  // accessed atomically, since it may be changed by SetBufferSize
+  bufsize  int64
+  queue    jobQueue
+  // counter of job group ids, accessed atomically
+  cnt      int64
+  groups   [jobGroupShards]jobGroupShard
+  // reservation of thread id 0
+  slot     chan struct{}
+  // scratch buffers indexed by thread id
+  scratch  [][]byte
+  // jobs currently executed by each thread
+  activity []threadActivity
+  // time at which the pool was started in nanoseconds since the epoch
+  started  int64
+  // number of workers that were replaced
+  respawns int64
+  // number of jobs executed at submission because the queue was full,
+  // and the count and time in nanoseconds since the epoch at which the
+  // saturation hook was last called
+  inline     int64
+  inlineLast int64
+  inlineTime int64
+  // number of running workers
+  alive    int32
+  // number of workers that execute jobs, workers with larger thread
+  // ids are parked (see SetActiveWorkers), accessed atomically
+  active   int32
+  parkMtx  sync.Mutex
+  parkCond *sync.Cond
+  // workers that exited because the pool was idle (see Hibernate),
+  // accessed atomically
+  sleeping []int32
+  sleepers int32
+  // set while the goroutine that lets workers hibernate is running
+  watching int32
+  // time since the queue is full in nanoseconds since the epoch, zero
+  // if the queue is not full
+  fullSince int64
+  // job groups that wait for other job groups
+  waits    waitGraph
+  // limits of jobs with the same key (see SetKeyLimit)
+  limits   keyLimits
+  // job group used by AddJobDefault and WaitDefault
+  defaultOnce  sync.Once
+  defaultGroup int
+  // counters of submitted and executed jobs, nil if disabled
+  counters *counters
+  // histograms of execution times, nil if disabled
+  histograms *histograms
+  // options
+  cancelOnError bool
+  cancelChildren bool
+  serialAfterStop bool
+  maxDepth      int
+  workersOnly   bool
+  workersOnlyWait bool
+  keepState     bool
+  serial        bool
+  seeded        bool
+  seed          int64
+  manual        bool
+  lockFree      bool
+  spin          time.Duration
+  targeted      bool
+  fair          bool
+  aging         int
+  lifo          bool
+  edf           bool
+  expvar        string
+  slowJobs      time.Duration
+  slowJobHook   func(SlowJob)
+  heartbeat     time.Duration
+  heartbeatHook func(ThreadSnapshot)
+  saturationInterval time.Duration
+  saturationHook     func(int64)
+  // hooks of queue watermarks, nil if disabled
+  watermarks    *watermarks
+  // adjusts the number of active workers while the pool is running
+  controller    func(jobQueue)
+  hibernate     time.Duration
+  rePanic       bool
+  quota         int
+  strict        bool
+  errorStacks   bool
+  name          string
+  quotaWait     bool
+  expectedGroups int
+  saturation    time.Duration
+  waiting       time.Duration
 }
 
 /* -------------------------------------------------------------------------- */
@@ -95,18 +455,15 @@ func (t *threadPool) NewJobGroup() int {
   if t == nil {
     return 0
   }
-  t.cntmtx.Lock()
-  defer t.cntmtx.Unlock()
   for {
-    // increment counter until no wait group is
-    // found
-    i := t.cnt; t.cnt += 1
-    t.wgmmtx.RLock()
-    if _, ok := t.wgm[i]; !ok {
-      t.wgmmtx.RUnlock()
+    // increment counter until no wait group is found, ids
+    // of existing groups are skipped, which may happen if
+    // the counter wraps around or if the id of a group was
+    // not obtained from NewJobGroup
+    i := int(atomic.AddInt64(&t.cnt, 1)-1) & maxJobGroup
+    if _, ok := t.lookupJobGroup(i); !ok {
       return i
     }
-    t.wgmmtx.RUnlock()
   }
 }
 
@@ -124,110 +481,552 @@ func (t *threadPool) Start() {
   if t == nil {
     return
   }
-  if t.channelOpen() {
+  if t.queue != nil && !t.queue.isClosed() {
+    return
+  }
+  // reset utilization
+  for i := range t.activity {
+    atomic.StoreInt64(&t.activity[i].busy, 0)
+  }
+  atomic.StoreInt64(&t.started, time.Now().UnixNano())
+  if t.serial {
+    // jobs are never queued, hence AddJob executes all jobs
+    // in submission order on the calling thread
+    t.queue = newMutexQueue(0)
+    return
+  }
+  switch {
+  case t.seeded:
+    // jobs are removed from the queue in pseudo-random order
+    q := newMutexQueue(t.bufferSize())
+    q.random = rand.New(rand.NewSource(t.seed))
+    t.queue = q
+  case t.lockFree && t.bufferSize() > 0:
+    t.queue = newRingQueue(t.bufferSize())
+  default:
+    q := newMutexQueue(t.bufferSize())
+    if t.bufferSize() == 0 && !t.manual {
+      q = newHandoffQueue(t.threads)
+    }
+    q.fair  = t.fair
+    q.aging = uint64(t.aging)
+    q.lifo  = t.lifo
+    q.edf   = t.edf
+    t.queue = q
+  }
+  if t.heartbeat > 0 {
+    go t.monitor(t.queue)
+  }
+  if t.controller != nil && !t.seeded && !t.manual {
+    go t.controller(t.queue)
+  }
+  if t.seeded || t.manual {
+    // no workers are started, queued jobs are executed by
+    // Wait and Step
     return
   }
-  t.channel = make(chan job, t.bufsize)
+  for i := range t.sleeping {
+    atomic.StoreInt32(&t.sleeping[i], 0)
+  }
+  atomic.StoreInt32(&t.sleepers, 0)
+  if t.hibernate > 0 && t.bufferSize() > 0 {
+    atomic.StoreInt32(&t.watching, 1)
+    go t.hibernation(t.queue)
+  }
   for i := 1; i < t.threads; i++ {
-    go func(i int) {
-      // start computing jobs
-      t.worker(i)
-    }(i)
+    // start computing jobs
+    t.spawn(t.queue, i)
+  }
+}
+
+// Stop the worker threads. Queued jobs are discarded, whereas running jobs
+// are completed. Returns the number of discarded jobs and a StopError if
+// job groups had outstanding jobs, whose Wait returns ErrStopped. Pools
+// that were returned by Nested share the workers of another pool, in which
+// case Stop has no effect
+func (t ThreadPool) Stop() (int, error) {
+  for s := t.sub; s != nil; s = s.pool.sub {
+    if s.nested {
+      return 0, nil
+    }
   }
+  return t.threadPool.Stop()
 }
 
-func (t *threadPool) Stop() {
+func (t *threadPool) Stop() (int, error) {
   if t == nil {
-    return
+    return 0, nil
+  }
+  if t.queue == nil || t.queue.isClosed() {
+    return 0, nil
+  }
+  t.queue.close()
+  // wake parked workers, so that they can exit
+  t.parkMtx.Lock()
+  t.parkCond.Broadcast()
+  t.parkMtx.Unlock()
+  // release the scratch buffer of thread id 0 unless it is in use,
+  // workers release their buffers when they exit
+  select {
+  case t.slot <- struct{}{}:
+    t.scratch[0] = nil
+    <- t.slot
+  default:
+  }
+  // discard queued jobs
+  n := 0
+  r := map[int]struct{}{}
+  for _, j := range t.queue.drain() {
+    r[j.jobGroup] = struct{}{}
+    m := 1
+    if j.gang != nil {
+      m = len(j.gang)
+    }
+    j.group.setErrorIfNil(ErrStopped)
+    j.group.wg.Add(-m)
+    if j.finish != nil {
+      j.finish()
+    }
+    n += m
+  }
+  // report groups with discarded or running jobs
+  for i := range t.groups {
+    shard := &t.groups[i]
+    shard.mtx.RLock()
+    for jobGroup, state := range shard.m {
+      if state.wg.Value() > 0 {
+        r[jobGroup] = struct{}{}
+      }
+    }
+    shard.mtx.RUnlock()
+  }
+  if n == 0 && len(r) == 0 {
+    return 0, nil
+  }
+  groups := make([]int, 0, len(r))
+  for jobGroup := range r {
+    groups = append(groups, jobGroup)
+  }
+  sort.Ints(groups)
+  return n, &StopError{Discarded: n, Groups: groups}
+}
+
+// True if the calling thread may execute jobs. With the WorkersOnly
+// option, only threads that execute jobs of the pool may do so
+func (t ThreadPool) callerRuns() bool {
+  return t.reserved || !t.workersOnly || !t.hasWorkers()
+}
+
+// True if this handle belongs to a job and the maximum number of nested
+// jobs on its thread is reached (see MaxDepth). Pools without workers
+// ignore the limit, since only the calling thread executes jobs
+func (t ThreadPool) tooDeep() bool {
+  return t.maxDepth > 0 && t.reserved && t.hasWorkers() && int(atomic.LoadInt32(&t.activity[t.threadId].depth)) >= t.maxDepth
+}
+
+// Returns ErrStopped if the pool was stopped
+func (t *threadPool) stopped() error {
+  if t.serialAfterStop {
+    return nil
+  }
+  if t.queue == nil || t.queue.isClosed() {
+    return ErrStopped
+  }
+  return nil
+}
+
+// Change the size of the queue to [n] without dropping queued jobs. If
+// the queue is shrunk below the number of queued jobs, further jobs are
+// only queued once enough jobs were removed. The size of unbuffered pools
+// and of lock-free queues cannot be changed
+func (t *threadPool) SetBufferSize(n int) error {
+  if t == nil {
+    return nil
+  }
+  if n < 1 {
+    return errors.New("threadpool: invalid buffer size")
+  }
+  if t.serial || t.bufferSize() == 0 {
+    return errors.New("threadpool: pool is unbuffered")
+  }
+  if t.queue != nil && !t.queue.resize(n) {
+    return errors.New("threadpool: queue cannot be resized")
+  }
+  atomic.StoreInt64(&t.bufsize, int64(n))
+  return nil
+}
+
+func (t *threadPool) bufferSize() int {
+  return int(atomic.LoadInt64(&t.bufsize))
+}
+
+// Returns a buffer of length [size] owned by thread [threadId], which is
+// reused by all jobs executed on this thread. The content of the buffer
+// is undefined and it must not be used after the job returns. Buffers
+// are released once the pool is stopped and the thread is idle. If
+// [threadId] is not a valid thread id, a new buffer is returned
+func (t *threadPool) Scratch(threadId, size int) []byte {
+  if t == nil || threadId < 0 || threadId >= len(t.scratch) {
+    return make([]byte, size)
+  }
+  if cap(t.scratch[threadId]) < size {
+    t.scratch[threadId] = make([]byte, size)
+  }
+  return t.scratch[threadId][:size]
+}
+
+// Returns a copy of all errors that were recorded so far and not yet
+// returned by Wait, indexed by job group
+func (t *threadPool) Errors() map[int]error {
+  r := make(map[int]error)
+  if t == nil {
+    return r
+  }
+  for i := range t.groups {
+    shard := &t.groups[i]
+    shard.mtx.RLock()
+    for jobGroup, state := range shard.m {
+      if err := state.getError(); err != nil {
+        r[jobGroup] = err
+      }
+    }
+    shard.mtx.RUnlock()
+  }
+  return r
+}
+
+// Returns the error recorded for [jobGroup] without clearing the
+// state of the job group
+func (t *threadPool) GroupError(jobGroup int) error {
+  if t == nil {
+    return nil
   }
-  if !t.channelOpen() {
+  return t.getError(jobGroup)
+}
+
+// Attach a deadline to [jobGroup]. With the DeadlineScheduling option,
+// jobs of the group with the earliest deadline are dispatched first. A zero
+// [deadline] removes the deadline. The deadline is released together with
+// the state of the job group
+func (t *threadPool) SetDeadline(jobGroup int, deadline time.Time) {
+  if t == nil {
     return
   }
-  close(t.channel)
+  d := int64(0)
+  if !deadline.IsZero() {
+    d = deadline.UnixNano()
+  }
+  atomic.StoreInt64(&t.getJobGroup(jobGroup).deadline, d)
 }
 
-/* -------------------------------------------------------------------------- */
+// Release the error and wait group of [jobGroup]. This is only required
+// if the pool was created with the KeepState option, otherwise Wait
+// clears the state of a job group
+func (t *threadPool) ClearJobGroup(jobGroup int) {
+  if t == nil {
+    return
+  }
+  t.clear(jobGroup)
+}
 
-func (t *threadPool) setError(jobGroup int, err error) {
-  t.errmtx.Lock()
-  t.err[jobGroup] = err
-  t.errmtx.Unlock()
+// Remove all recorded errors
+func (t *threadPool) ClearErrors() {
+  if t == nil {
+    return
+  }
+  for i := range t.groups {
+    shard := &t.groups[i]
+    shard.mtx.RLock()
+    for _, state := range shard.m {
+      state.setError(nil)
+    }
+    shard.mtx.RUnlock()
+  }
 }
 
+/* -------------------------------------------------------------------------- */
+
 func (t *threadPool) getError(jobGroup int) error {
-  t.errmtx.RLock()
-  defer t.errmtx.RUnlock()
-  if err, ok := t.err[jobGroup]; ok {
-    return err
+  if state, ok := t.lookupJobGroup(jobGroup); ok {
+    return state.getError()
   } else {
     return nil
   }
 }
 
+func (t *threadPool) shard(jobGroup int) *jobGroupShard {
+  return &t.groups[uint(jobGroup) % jobGroupShards]
+}
+
+func (t *threadPool) lookupJobGroup(jobGroup int) (*jobGroupState, bool) {
+  shard := t.shard(jobGroup)
+  shard.mtx.RLock()
+  defer shard.mtx.RUnlock()
+  state, ok := shard.m[jobGroup]
+  return state, ok
+}
+
+// Get state of [jobGroup], which is created if it does not exist
+// With the StrictGroups option, returns ErrUnknownGroup if [jobGroup] was
+// not obtained from NewJobGroup
+func (t *threadPool) checkGroup(jobGroup int) error {
+  if t.strict && (jobGroup < 0 || int64(jobGroup) >= atomic.LoadInt64(&t.cnt)) {
+    return ErrUnknownGroup
+  }
+  return nil
+}
+
+func (t *threadPool) getJobGroup(jobGroup int) *jobGroupState {
+  if state, ok := t.lookupJobGroup(jobGroup); ok {
+    return state
+  }
+  shard := t.shard(jobGroup)
+  shard.mtx.Lock()
+  defer shard.mtx.Unlock()
+  // check again, state might have been created in the meantime
+  if state, ok := shard.m[jobGroup]; ok {
+    return state
+  }
+  state := shard.newJobGroupState()
+  state.hist = t.histograms.get(jobGroup)
+  if t.quota > 0 {
+    state.quota = make(chan struct{}, t.quota)
+  }
+  shard.m[jobGroup] = state
+  return state
+}
+
+// Clear error and wait group of [jobGroup]
 func (t *threadPool) clear(jobGroup int) {
-  // clear error
-  t.errmtx.Lock()
-  delete(t.err, jobGroup)
-  t.errmtx.Unlock()
-  // clear wait group
-  t.wgmmtx.Lock()
-  delete(t.wgm, jobGroup)
-  t.wgmmtx.Unlock()
+  shard := t.shard(jobGroup)
+  shard.mtx.Lock()
+  state, ok := shard.m[jobGroup]
+  delete(shard.m, jobGroup)
+  shard.mtx.Unlock()
+  if ok {
+    state.release()
+  }
 }
 
-func (t *threadPool) getWaitGroup(jobGroup int) *waitGroup {
-  t.wgmmtx.RLock()
-  if wg, ok := t.wgm[jobGroup]; ok {
-    t.wgmmtx.RUnlock()
-    return wg
+// Remove all queued jobs of a job group
+func (t *threadPool) cancel(group *jobGroupState) {
+  if n := t.queue.remove(group); n > 0 {
+    group.wg.Add(-n)
   }
-  t.wgmmtx.RUnlock()
-  // add new wait group
-  wg := newWaitGroup()
-  t.wgmmtx.Lock()
-  t.wgm[jobGroup] = wg
-  t.wgmmtx.Unlock()
-  return wg
 }
 
-func (t *threadPool) worker(i int) {
-  for job := range t.channel {
-    getError := func() error {
-      return t.getError(job.jobGroup)
+// Execute job and record its error. The kind of thread that executes
+// the job is given by [by]
+func (t *threadPool) execute(pool ThreadPool, j job, by int) {
+  t.watermarks.check(t.queue)
+  defer j.group.done()
+  if j.finish != nil {
+    defer j.finish()
+  }
+  if t.dropped(j.group) {
+    // job group already failed, drop job
+    if j.member {
+      j.group.barrier.leave()
+    }
+    return
+  }
+  start    := time.Now()
+  activity := &t.activity[pool.threadId]
+  defer activity.restore(activity.set(j.jobGroup, start))
+  pool.meta      = j.meta
+  pool.metaGroup = j.group
+  pool.held      = nil
+  err := callJob(j.f, pool, j.group.erf)
+  if err != nil {
+    if e, ok := nestedJobError(err); ok {
+      err = e
+    } else {
+      e := newJobError(err, j, pool.threadId, pool.Metadata())
+      if t.errorStacks {
+        // the frames of the job are gone, but the stack shows
+        // how the job was executed
+        e.Stack = debug.Stack()
+      }
+      err = e
+    }
+  }
+  d := time.Since(start)
+  j.group.stats.observe(d, by)
+  if j.group.hist != nil || t.slowJobs > 0 {
+    if j.group.hist != nil {
+      j.group.hist.observe(d)
+    }
+    if t.slowJobs > 0 && d >= t.slowJobs {
+      t.slowJobHook(SlowJob{JobGroup: j.jobGroup, ThreadId: pool.threadId, Start: start, Duration: d, Err: err, Metadata: pool.Metadata()})
     }
-    if err := job.f(ThreadPool{t, i}, getError); err != nil {
-      t.setError(job.jobGroup, err)
+  }
+  t.counters.add(counterCompleted, 1)
+  if err != nil {
+    t.counters.add(counterFailed, 1)
+    j.group.setError(err)
+    if t.cancelOnError {
+      t.cancel(j.group)
+    }
+    if t.cancelChildren {
+      t.cancelDescendants(j.group)
     }
   }
 }
 
-func (t *threadPool) channelOpen() bool {
-  if t.channel == nil {
-    return false
-  }
-  select {
-  case job, ok := <- t.channel:
+func (t *threadPool) hasWorkers() bool {
+  return !t.serial && !t.seeded && !t.manual
+}
+
+// Start worker [i], which is counted as alive before its goroutine is
+// scheduled
+func (t *threadPool) spawn(q jobQueue, i int) {
+  atomic.AddInt32(&t.alive, 1)
+  go t.worker(q, i)
+}
+
+func (t *threadPool) worker(q jobQueue, i int) {
+  // label the goroutine, so that workers can be identified in
+  // goroutine profiles
+  pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels("threadpool", t.name, "worker", strconv.Itoa(i))))
+  stopped := false
+  defer func() {
+    atomic.AddInt32(&t.alive, -1)
+    if !stopped {
+      // the worker was terminated by a job, i.e. the job called
+      // runtime.Goexit, start a replacement
+      atomic.AddInt64(&t.respawns, 1)
+      t.spawn(q, i)
+    }
+  }()
+  for {
+    if !t.waitActive(q, i) {
+      stopped = true
+      return
+    }
+    job, ok := t.spinPop(q)
     if !ok {
-      return false
+      job, ok = q.pop(i)
     }
-    // threadpool already active (job received)
-    t.channel <- job
-    return true
-  default:
-    // threadpool already active (no jobs)
+    if !ok {
+      // either the queue is closed or the worker was released
+      // because the pool is idle
+      if q.isClosed() {
+        // no job is executed on this thread anymore
+        t.scratch[i] = nil
+        stopped = true
+        return
+      }
+      if t.sleep(q, i) {
+        stopped = true
+        return
+      }
+      continue
+    }
+    t.execute(ThreadPool{threadPool: t, threadId: i, reserved: true}, job, byWorker)
+  }
+}
+
+// Block while worker [i] is parked. Returns false if [q] was closed
+// in the meantime
+func (t *threadPool) waitActive(q jobQueue, i int) bool {
+  if int(atomic.LoadInt32(&t.active)) >= i {
     return true
   }
+  t.parkMtx.Lock()
+  defer t.parkMtx.Unlock()
+  for int(atomic.LoadInt32(&t.active)) < i {
+    if q.isClosed() {
+      return false
+    }
+    t.parkCond.Wait()
+  }
+  return true
+}
+
+// Returns the number of workers that currently execute jobs
+func (t *threadPool) ActiveWorkers() int {
+  if t == nil {
+    return 0
+  }
+  return int(atomic.LoadInt32(&t.active))
+}
+
+// Change the number of workers that execute jobs to [n], which is
+// limited to the range [1, NumberOfThreads()-1]. Further workers are
+// parked after finishing their current job, or the next job if they are
+// idle, until they are activated again. Gang jobs and semaphores that
+// require more than [n] workers are delayed until enough workers are
+// active
+func (t *threadPool) SetActiveWorkers(n int) {
+  if t == nil {
+    return
+  }
+  if n > t.threads-1 {
+    n = t.threads-1
+  }
+  if n < 1 {
+    n = 1
+  }
+  t.parkMtx.Lock()
+  atomic.StoreInt32(&t.active, int32(n))
+  t.parkCond.Broadcast()
+  t.parkMtx.Unlock()
+}
+
+// Poll the queue for the configured spin time before the
+// worker blocks
+func (t *threadPool) spinPop(q jobQueue) (job, bool) {
+  if t.spin <= 0 {
+    return job{}, false
+  }
+  deadline := time.Now().Add(t.spin)
+  for {
+    if j, ok := q.tryPop(); ok {
+      return j, true
+    }
+    if time.Now().After(deadline) {
+      return job{}, false
+    }
+    runtime.Gosched()
+  }
 }
 
 /* -------------------------------------------------------------------------- */
 
+// Interface implemented by ThreadPool. Code that accepts a Pool instead
+// of a ThreadPool can be tested with fakes or instrumented decorators
+type Pool interface {
+  NewJobGroup() int
+  NumberOfThreads() int
+  GetThreadId() int
+  AddJob(jobGroup int, f func(pool ThreadPool, erf func() error) error) error
+  AddRangeJob(iFrom, iTo int, jobGroup int, f func(i int, pool ThreadPool, erf func() error) error) error
+  Wait(jobGroup int) error
+}
+
+var _ Pool = ThreadPool{}
+
+/* -------------------------------------------------------------------------- */
+
 type ThreadPool struct {
   *threadPool
   // main thread id
   threadId int
+  // true if the thread id is reserved by the thread
+  // using this handle
+  reserved bool
+  // limits the number of jobs submitted through this handle
+  sub      *subPool
+  // sub-pool through which the job of this handle was dispatched,
+  // i.e. whose slot is held by the job
+  held     *subPool
+  // metadata of the job executed with this handle
+  meta      Metadata
+  metaGroup *jobGroupState
 }
 
-// Get the ID of the main thread
+// Get the ID of the main thread. Threads that execute jobs at the same
+// time always have distinct ids in the range [0, NumberOfThreads())
 func (t ThreadPool) GetThreadId() int {
   if t.NumberOfThreads() == 1 {
     return 0
@@ -235,141 +1034,752 @@ func (t ThreadPool) GetThreadId() int {
   return t.threadId
 }
 
+// Threads that are not workers of the pool share thread id 0, which must
+// be reserved before executing a job. This guarantees that all threads
+// currently executing jobs have unique ids. If [done] is nil, false is
+// returned if the id is in use by another thread. Otherwise, the call
+// blocks until either the id is released or [done] is closed
+func (t ThreadPool) reserveThreadId(done <-chan struct{}) (ThreadPool, bool) {
+  if t.reserved {
+    return t, true
+  }
+  if done == nil && t.hasWorkers() {
+    select {
+    case t.slot <- struct{}{}:
+    default:
+      return t, false
+    }
+  } else {
+    // if there are no workers, jobs are only executed by threads
+    // outside the pool, hence always wait until the id is released
+    select {
+    case t.slot <- struct{}{}:
+    case <- done:
+      return t, false
+    }
+  }
+  return ThreadPool{threadPool: t.threadPool, threadId: 0, reserved: true}, true
+}
+
+func (t ThreadPool) releaseThreadId() {
+  if !t.reserved {
+    <- t.slot
+  }
+}
+
 /* -------------------------------------------------------------------------- */
 
 // Wait until all jobs in [jobGroup] are done. The main thread is then used
-// as a worker to process jobs
+// as a worker to process jobs, including jobs that are submitted while
+// waiting. If the pool was stopped, Wait returns ErrStopped once the
+// remaining jobs of the group are done, unless a job failed
 func (t ThreadPool) Wait(jobGroup int) error {
+  _, err := t.WaitStats(jobGroup)
+  return err
+}
+
+// Same as Wait, but also returns a summary of the jobs of [jobGroup] that
+// were executed since the state of the group was created. Pools with only
+// one thread do not record any statistics
+func (t ThreadPool) WaitStats(jobGroup int) (GroupStats, error) {
   if t.NumberOfThreads() == 1 {
-    return nil
+    return GroupStats{}, nil
   }
-  t.wgmmtx.RLock()
-  if wg, ok := t.wgm[jobGroup]; !ok {
-    t.wgmmtx.RUnlock()
+  state, ok := t.lookupJobGroup(jobGroup)
+  if !ok {
     // wait group has not been created, nothing
     // to wait for
-    return nil
+    return GroupStats{}, t.stopped()
   } else {
-    t.wgmmtx.RUnlock()
-    // act as a worker until all jobs of this jobGroup are done
-  LOOP:
-    for {
-      if wg.Value() == 0 {
-        break LOOP
-      }
-      select {
-      case job := <- t.channel:
-        getError := func() error {
-          return t.getError(job.jobGroup)
+    if t.reserved {
+      // called within a job, check that the group of the job
+      // is not waited for
+      if g, _, ok := t.activity[t.threadId].get(); ok {
+        if !t.waits.add(g, jobGroup) {
+          return GroupStats{}, ErrDeadlock
         }
-        if err := job.f(t, getError); err != nil {
-          t.setError(job.jobGroup, err)
-        }
-      default:
-        // job channel is empty, wait for all jobs
-        // to complete and exit loop
-        wg.Wait()
-        break LOOP
+        defer t.waits.remove(g, jobGroup)
+      }
+      // jobs of sub-pools that wait do not count against the
+      // limits of the sub-pools they were dispatched through
+      for s := t.held; s != nil; s = s.pool.sub {
+        s.block()
+        defer s.unblock()
+      }
+    }
+    wg := state.wg
+    // act as a worker until all jobs of this jobGroup are done,
+    // unless too many jobs are nested on this thread
+    for !t.tooDeep() && t.callerRuns() {
+      done := wg.Channel()
+      // the thread id is released after each job, so that other
+      // waiting threads can take turns helping
+      pool, ok := t.reserveThreadId(done)
+      if !ok {
+        break
+      }
+      // block until either a new job is available or
+      // all jobs of this group are done
+      var target *jobGroupState
+      if t.targeted {
+        target = state
+      }
+      job, ok := t.queue.waitPop(target, pool.threadId, done)
+      if ok {
+        t.execute(pool, job, byWaiter)
+      }
+      t.releaseThreadId()
+      if !ok {
+        break
       }
     }
+    wg.Wait()
   }
-  // get error message and return
-  err := t.getError(jobGroup)
-  t.clear(jobGroup)
-  return err
+  return t.waited(jobGroup, state)
 }
 
-/* simple job queuing
- * -------------------------------------------------------------------------- */
+// Returns the summary and error of [jobGroup] once all its jobs are done
+// and clears the state of the group
+func (t ThreadPool) waited(jobGroup int, state *jobGroupState) (GroupStats, error) {
+  err   := state.getError()
+  stats := state.stats.get()
+  if err == nil {
+    err = t.stopped()
+  }
+  if !t.keepState {
+    t.clear(jobGroup)
+  }
+  if t.rePanic {
+    var e PanicError
+    if errors.As(err, &e) {
+      panic(RePanicError{e})
+    }
+  }
+  return stats, err
+}
+
+// True if all jobs of [jobGroup] are done. In contrast to Wait, no jobs
+// are executed and the state of the group is not cleared
+func (t ThreadPool) IsDone(jobGroup int) bool {
+  return t.Remaining(jobGroup) == 0
+}
+
+// Returns the number of jobs of [jobGroup] that are queued, running or
+// kept back, i.e. the number of jobs Wait still waits for. Jobs of range
+// jobs are counted per chunk
+func (t ThreadPool) Remaining(jobGroup int) int {
+  if t.NumberOfThreads() == 1 {
+    return 0
+  }
+  state, ok := t.lookupJobGroup(jobGroup)
+  if !ok {
+    return 0
+  }
+  return state.wg.Value()
+}
+
+// Same as Wait, but returns false immediately if jobs of [jobGroup] are
+// still pending. The calling thread never executes jobs
+func (t ThreadPool) TryWait(jobGroup int) (bool, error) {
+  if t.NumberOfThreads() == 1 {
+    return true, nil
+  }
+  state, ok := t.lookupJobGroup(jobGroup)
+  if !ok {
+    return true, t.stopped()
+  }
+  if state.wg.Value() > 0 {
+    return false, nil
+  }
+  _, err := t.waited(jobGroup, state)
+  return true, err
+}
+
+// Execute a single queued job on the calling thread. Returns false if
+// no job was queued or if the thread id is in use by another thread
+func (t ThreadPool) Step() bool {
+  if t.NumberOfThreads() == 1 {
+    return false
+  }
+  pool, ok := t.reserveThreadId(nil)
+  if !ok {
+    return false
+  }
+  defer t.releaseThreadId()
+  if job, ok := t.queue.tryPop(); ok {
+    t.execute(pool, job, byWaiter)
+    return true
+  }
+  return false
+}
+
+/* simple job queuing
+ * -------------------------------------------------------------------------- */
 
 // Submit a single job to the queue. If the pool consists
-// of only one thread then the job is processed immediately
+// of only one thread then the job is processed immediately. Returns
+// ErrStopped if the pool was stopped
 func (t ThreadPool) AddJob(jobGroup int, f func(pool ThreadPool, erf func() error) error) error {
+  return t.addJob(jobGroup, job{f: f})
+}
+
+// Submit a single job that requires neither the pool nor the error of its
+// job group
+func (t ThreadPool) AddFunc(jobGroup int, f func() error) error {
+  return t.addJob(jobGroup, job{f: func(pool ThreadPool, erf func() error) error {
+    return f()
+  }})
+}
+
+// Submit a single job that receives the context of its job group instead
+// of the error probe. The context is cancelled as soon as a job of the
+// group fails, and when the state of the group is released
+func (t ThreadPool) AddContextJob(jobGroup int, f func(ctx context.Context, pool ThreadPool) error) error {
   if t.NumberOfThreads() == 1 {
-    getError := func() error {
-      return nil
+    return t.addJob(jobGroup, job{f: func(pool ThreadPool, erf func() error) error {
+      return f(context.Background(), pool)
+    }})
+  }
+  if err := t.checkGroup(jobGroup); err != nil {
+    return err
+  }
+  ctx := t.getJobGroup(jobGroup).getContext()
+  return t.addJob(jobGroup, job{f: func(pool ThreadPool, erf func() error) error {
+    return f(ctx, pool)
+  }})
+}
+
+// Submit a single job with metadata [md], which is available to the job
+// through Metadata and attached to its error and to reports of slow jobs
+func (t ThreadPool) AddJobWithMetadata(jobGroup int, md Metadata, f func(pool ThreadPool, erf func() error) error) error {
+  return t.addJob(jobGroup, job{f: f, meta: md})
+}
+
+// Submit a single job with [priority]. Queued jobs of the same job group
+// are dispatched in the order of decreasing priority, and in submission
+// order if their priorities are equal. Jobs submitted by AddJob have
+// priority zero. Not supported by the LockFreeQueue
+func (t ThreadPool) AddJobWithPriority(jobGroup, priority int, f func(pool ThreadPool, erf func() error) error) error {
+  return t.addJob(jobGroup, job{f: f, priority: priority})
+}
+
+// Submit a single job with affinity [key]. Jobs with the same key are
+// executed by the same worker as long as the number of active workers does
+// not change, so that workers can reuse caches indexed by GetThreadId. If
+// the queue is full, the job is executed by the submitting thread only if
+// it executes a job of the pool itself. Jobs are not pinned if the pool has
+// no workers or uses the LockFreeQueue
+func (t ThreadPool) AddJobWithKey(jobGroup int, key string, f func(pool ThreadPool, erf func() error) error) error {
+  return t.addJob(jobGroup, job{f: f, worker: t.affinity(key)})
+}
+
+// Returns the worker to which jobs with affinity [key] are pinned
+func (t ThreadPool) affinity(key string) int {
+  if t.NumberOfThreads() == 1 || !t.hasWorkers() || t.lockFree {
+    return 0
+  }
+  h := fnv.New32a()
+  h.Write([]byte(key))
+  return 1 + int(h.Sum32() % uint32(t.ActiveWorkers()))
+}
+
+// Same as AddJob, but the job is never executed by the calling thread,
+// unless the pool is Serial. If the queue is full, wait at most [d] for
+// space in the queue. If the job could not be queued in time, the returned
+// error matches both ErrQueueFull and ErrTimeout
+func (t ThreadPool) AddJobTimeout(jobGroup int, d time.Duration, f func(pool ThreadPool, erf func() error) error) error {
+  if d <= 0 {
+    d = time.Nanosecond
+  }
+  return t.addJob(jobGroup, job{f: f, timeout: d})
+}
+
+func (t ThreadPool) addJob(jobGroup int, j job) error {
+  if t.NumberOfThreads() == 1 {
+    t.meta = j.meta
+    if err := callJob(j.f, t, noError); err != nil {
+      if e, ok := nestedJobError(err); ok {
+        return e
+      }
+      return newJobError(err, job{jobGroup: jobGroup}, 0, j.meta)
     }
-    if err := f(t, getError); err != nil {
+  } else {
+    if err := t.checkGroup(jobGroup); err != nil {
       return err
     }
-  } else {
-    wg := t.getWaitGroup(jobGroup)
-    wg.Add(1)
+    state := t.getJobGroup(jobGroup)
+    if t.dropped(state) {
+      // job group already failed, drop job
+      return ErrCancelled
+    }
+    t.recordParent(jobGroup, state)
+    state.wg.Add(1)
 
-    g := func(pool ThreadPool, erf func() error) error {
-      defer wg.Done()
-      return f(pool, erf)
+    j.jobGroup = jobGroup
+    j.group    = state
+    j.index    = state.nextIndex(1)
+    if err := t.submitQuota(j); err != nil {
+      return err
     }
-    select {
-    case t.channel <- job{g, jobGroup}:
-    default:
-      // channel buffer is full, execute job here
-      getError := func() error {
-        return t.getError(jobGroup)
+    t.counters.add(counterSubmitted, 1)
+  }
+  return nil
+}
+
+// Register a job of [jobGroup] that is executed outside of the pool, for
+// instance by a remote process. Wait does not return before the returned
+// function was called with the result of the job, which must happen exactly
+// once. Not supported by pools with only one thread
+func (t ThreadPool) AddAsyncJob(jobGroup int) (func(error), error) {
+  if t.NumberOfThreads() == 1 {
+    return nil, errors.New("threadpool: asynchronous jobs require a pool with more than one thread")
+  }
+  if t.queue == nil || t.queue.isClosed() {
+    return nil, ErrStopped
+  }
+  if err := t.checkGroup(jobGroup); err != nil {
+    return nil, err
+  }
+  state := t.getJobGroup(jobGroup)
+  if t.dropped(state) {
+    // job group already failed, drop job
+    return nil, ErrCancelled
+  }
+  state.wg.Add(1)
+  t.counters.add(counterSubmitted, 1)
+  return func(err error) {
+    if err != nil {
+      state.setError(err)
+      if t.cancelOnError {
+        t.cancel(state)
       }
-      if err := g(t, getError); err != nil {
-        t.setError(jobGroup, err)
+      if t.cancelChildren {
+        t.cancelDescendants(state)
       }
     }
+    state.wg.Done()
+  }, nil
+}
+
+// Buffers for submitting batches of jobs, which are reused to avoid
+// allocations
+var jobBatches = sync.Pool{
+  New: func() interface{} {
+    return new([]job)
+  },
+}
+
+// Submit several jobs of the same group with a single queue operation.
+// Jobs that do not fit into the queue are treated as in AddJob
+func (t ThreadPool) addJobs(jobGroup int, fs []func(pool ThreadPool, erf func() error) error) error {
+  if t.NumberOfThreads() == 1 {
+    for _, f := range fs {
+      if err := t.AddJob(jobGroup, f); err != nil {
+        return err
+      }
+    }
+    return nil
+  }
+  if err := t.checkGroup(jobGroup); err != nil {
+    return err
+  }
+  state := t.getJobGroup(jobGroup)
+  if t.dropped(state) {
+    // job group already failed, drop jobs
+    return ErrCancelled
   }
+  t.recordParent(jobGroup, state)
+  state.wg.Add(len(fs))
+
+  index := state.nextIndex(len(fs))
+  buf   := jobBatches.Get().(*[]job)
+  jobs  := (*buf)[:0]
+  for i, f := range fs {
+    jobs = append(jobs, job{f: f, jobGroup: jobGroup, group: state, index: index+i})
+  }
+  defer func() {
+    // release references held by the jobs before the
+    // buffer is reused
+    for i := range jobs {
+      jobs[i] = job{}
+    }
+    *buf = jobs[:0]
+    jobBatches.Put(buf)
+  }()
+  n := 0
+  if t.sub == nil && t.quota == 0 {
+    n = t.queue.tryPushBatch(jobs)
+    t.wake()
+    t.watermarks.check(t.queue)
+  }
+  for i := n; i < len(jobs); i++ {
+    if err := t.submitQuota(jobs[i]); err != nil {
+      // remaining jobs are not submitted
+      state.wg.Add(i+1-len(jobs))
+      t.counters.add(counterSubmitted, i)
+      return err
+    }
+  }
+  t.counters.add(counterSubmitted, len(jobs))
   return nil
 }
 
-// Submit a range job to the queue. The range [iFrom,ito) is split into
-// chunks of equal size which are then queued independently
-func (t ThreadPool) AddRangeJob(iFrom, iTo int, jobGroup int, f func(i int, pool ThreadPool, erf func() error) error) error {
-  if iFrom >= iTo {
-    return nil
+// If called within a job of another group, record this group as parent
+// of [jobGroup]
+func (t ThreadPool) recordParent(jobGroup int, state *jobGroupState) {
+  if !t.reserved || atomic.LoadInt32(&state.hasParent) != 0 {
+    return
+  }
+  if g, _, ok := t.activity[t.threadId].get(); ok && g != jobGroup {
+    state.setParent(g)
+  }
+}
+
+// Submit job subject to the quota of its job group. If the quota is
+// exhausted, either ErrQuotaExceeded is returned or the calling thread
+// blocks until a job of the group is done. Threads executing jobs of the
+// pool do not block, since the group might never make progress, instead
+// they execute the job themselves
+func (t ThreadPool) submitQuota(j job) error {
+  q := j.group.quota
+  if q == nil {
+    return t.submit(j)
+  }
+  select {
+  case q <- struct{}{}:
+  default:
+    switch {
+    case !t.quotaWait:
+      j.group.wg.Done()
+      return ErrQuotaExceeded
+    case t.reserved:
+      t.inlined()
+      t.execute(t, j, bySubmitter)
+      return nil
+    default:
+      q <- struct{}{}
+    }
+  }
+  finish := j.finish
+  j.finish = func() {
+    <- q
+    if finish != nil {
+      finish()
+    }
+  }
+  return t.submit(j)
+}
+
+// Submit job subject to the limit of its key to the sub-pool of this
+// handle or to the queue
+func (t ThreadPool) submit(j job) error {
+  if l := j.limit; l != nil {
+    j.limit = nil
+    return l.submit(t, j)
+  }
+  if t.sub != nil {
+    return t.sub.submit(j)
+  }
+  return t.enqueue(j)
+}
+
+// Push job to the queue. If the queue is full, the job is executed by
+// the calling thread
+func (t ThreadPool) enqueue(j job) error {
+  err := t.queue.tryPush(j)
+  if err == nil {
+    if atomic.LoadInt64(&t.fullSince) != 0 {
+      atomic.StoreInt64(&t.fullSince, 0)
+    }
+  }
+  if err == ErrStopped && t.serialAfterStop {
+    // execute job on the calling thread, block if thread id 0
+    // is in use
+    pool, _ := t.reserveThreadId(make(chan struct{}))
+    t.execute(pool, j, bySubmitter)
+    t.releaseThreadId()
+    err = nil
+  }
+  if err == ErrQueueFull {
+    atomic.CompareAndSwapInt64(&t.fullSince, 0, time.Now().UnixNano())
+    if j.timeout > 0 && !t.serial {
+      err = t.queue.pushTimeout(j, j.timeout)
+    } else if t.handoff() {
+      // no worker is idle, wait until the job can be handed
+      // over to a worker
+      err = t.queue.push(j)
+    } else if j.worker != 0 && !t.reserved {
+      // pinned job, wait until the job can be queued
+      err = t.queue.push(j)
+    } else if !t.callerRuns() {
+      // job must be executed by a worker, either wait until
+      // the job can be queued or return ErrQueueFull
+      if t.workersOnlyWait {
+        err = t.queue.push(j)
+      }
+    } else if t.tooDeep() {
+      // do not nest further jobs on this thread, wait until
+      // the job can be queued
+      err = t.queue.push(j)
+    } else if pool, ok := t.reserveThreadId(nil); ok {
+      // queue is full, execute job here
+      t.inlined()
+      t.execute(pool, j, bySubmitter)
+      t.releaseThreadId()
+      err = nil
+    } else {
+      // thread id is in use by another thread, wait
+      // until the job can be queued
+      err = t.queue.push(j)
+    }
+  }
+  if err == nil {
+    t.wake()
+    t.watermarks.check(t.queue)
+  }
+  if err != nil {
+    j.group.wg.Done()
+    if j.finish != nil {
+      j.finish()
+    }
   }
+  return err
+}
+
+// Count a job that is executed by the submitting thread because the
+// queue is full
+func (t *threadPool) inlined() {
+  t.counters.add(counterInline, 1)
+  n := atomic.AddInt64(&t.inline, 1)
+  if t.saturationHook == nil {
+    return
+  }
+  now  := time.Now().UnixNano()
+  last := atomic.LoadInt64(&t.inlineTime)
+  if now - last < int64(t.saturationInterval) || !atomic.CompareAndSwapInt64(&t.inlineTime, last, now) {
+    return
+  }
+  t.saturationHook(n - atomic.SwapInt64(&t.inlineLast, n))
+}
+
+// True if jobs submitted through this handle block until a worker is
+// idle. Jobs submitted through the handle of a job are never blocked,
+// since all workers might be waiting for each other
+func (t ThreadPool) handoff() bool {
+  return t.bufferSize() == 0 && t.hasWorkers() && !t.reserved
+}
+
+// Chunk of a range job
+type Chunk struct {
+  // position of the chunk in submission order
+  Index int
+  // range [From,To) of the chunk
+  From  int
+  To    int
+}
+
+// Size of the chunks of a range job, where the last chunk might be
+// smaller
+func (t ThreadPool) chunkSize(iFrom, iTo int) int {
   m := t.NumberOfThreads()
   if m > iTo-iFrom {
     m = iTo-iFrom
   }
-  n := (iTo-iFrom)/m
+  return (iTo-iFrom)/m
+}
+
+// Returns the chunks into which AddRangeJob and AddRangeJob_ split the
+// range [iFrom,iTo)
+func (t ThreadPool) RangeChunks(iFrom, iTo int) []Chunk {
+  if iFrom >= iTo {
+    return nil
+  }
+  n := t.chunkSize(iFrom, iTo)
+  r := []Chunk{}
+  for j := iFrom; j < iTo; j += n {
+    c := Chunk{Index: len(r), From: j, To: j+n}
+    if c.To > iTo {
+      c.To = iTo
+    }
+    r = append(r, c)
+  }
+  return r
+}
+
+// Same as AddRangeJob, but also returns the chunks that were submitted,
+// which allows to log or verify the partitioning of the range
+func (t ThreadPool) AddRangeJobChunks(iFrom, iTo int, jobGroup int, f func(i int, pool ThreadPool, erf func() error) error) ([]Chunk, error) {
+  if err := t.AddRangeJob(iFrom, iTo, jobGroup, f); err != nil {
+    return nil, err
+  }
+  return t.RangeChunks(iFrom, iTo), nil
+}
+
+// Submit a range job to the queue. The range [iFrom,ito) is split into
+// chunks of equal size which are then queued together
+func (t ThreadPool) AddRangeJob(iFrom, iTo int, jobGroup int, f func(i int, pool ThreadPool, erf func() error) error) error {
+  if iFrom >= iTo {
+    return nil
+  }
+  n  := t.chunkSize(iFrom, iTo)
+  fs := []func(pool ThreadPool, erf func() error) error{}
   for j := iFrom; j < iTo; j += n {
     iFrom_ := j
     iTo_   := j+n
     if iTo_ > iTo {
       iTo_ = iTo
     }
-    if err := t.AddJob(jobGroup, func(pool ThreadPool, erf func() error) error {
+    fs = append(fs, func(pool ThreadPool, erf func() error) error {
       for i := iFrom_; i < iTo_; i++ {
         if err := f(i, pool, erf); err != nil {
-          return err
+          return rangeError{i, err}
         }
       }
       return nil
-    }); err != nil {
-      return err
-    }
+    })
   }
-  return nil
+  return t.addJobs(jobGroup, fs)
 }
 
 func (t ThreadPool) AddRangeJob_(iFrom, iTo int, jobGroup int, f func(ifrom, ito int, pool ThreadPool, erf func() error) error) error {
   if iFrom >= iTo {
     return nil
   }
-  m := t.NumberOfThreads()
-  if m > iTo-iFrom {
-    m = iTo-iFrom
-  }
-  n := (iTo-iFrom)/m
+  n  := t.chunkSize(iFrom, iTo)
+  fs := []func(pool ThreadPool, erf func() error) error{}
   for j := iFrom; j < iTo; j += n {
     iFrom_ := j
     iTo_   := j+n
     if iTo_ > iTo {
       iTo_ = iTo
     }
-    if err := t.AddJob(jobGroup, func(pool ThreadPool, erf func() error) error {
+    fs = append(fs, func(pool ThreadPool, erf func() error) error {
       if err := f(iFrom_, iTo_, pool, erf); err != nil {
         return err
       }
       return nil
-    }); err != nil {
-      return err
+    })
+  }
+  return t.addJobs(jobGroup, fs)
+}
+
+// Split [iFrom,iTo) into at most [m] consecutive chunks of roughly equal
+// total cost
+func weightedChunks(iFrom, iTo, m int, cost func(i int) float64) [][2]int {
+  c     := make([]float64, iTo-iFrom)
+  total := 0.0
+  for i := range c {
+    c[i]   = cost(iFrom+i)
+    total += c[i]
+  }
+  if total <= 0.0 {
+    // no cost information, split range equally
+    for i := range c {
+      c[i] = 1.0
+    }
+    total = float64(len(c))
+  }
+  r := [][2]int{}
+  s := 0.0
+  j := iFrom
+  for i := iFrom; i < iTo; i++ {
+    s += c[i-iFrom]
+    if i+1 == iTo || s >= float64(len(r)+1)*total/float64(m) {
+      r = append(r, [2]int{j, i+1})
+      j = i+1
     }
   }
+  return r
+}
+
+// Submit a range job where the range is split into chunks of roughly equal
+// total cost instead of equal size, where [cost] returns the estimated cost
+// of iteration i. This balances the load of loops with skewed costs, such as
+// triangular loops
+func (t ThreadPool) AddWeightedRangeJob(iFrom, iTo int, jobGroup int, cost func(i int) float64, f func(i int, pool ThreadPool, erf func() error) error) error {
+  if iFrom >= iTo {
+    return nil
+  }
+  m := t.NumberOfThreads()
+  if m > iTo-iFrom {
+    m = iTo-iFrom
+  }
+  fs := []func(pool ThreadPool, erf func() error) error{}
+  for _, chunk := range weightedChunks(iFrom, iTo, m, cost) {
+    iFrom_ := chunk[0]
+    iTo_   := chunk[1]
+    fs = append(fs, func(pool ThreadPool, erf func() error) error {
+      for i := iFrom_; i < iTo_; i++ {
+        if err := f(i, pool, erf); err != nil {
+          return rangeError{i, err}
+        }
+      }
+      return nil
+    })
+  }
+  return t.addJobs(jobGroup, fs)
+}
+
+/* gang scheduling
+ * -------------------------------------------------------------------------- */
+
+// Submit a range job whose chunks are guaranteed to start at the same time.
+// The range [iFrom,iTo) is split into at most NumberOfThreads()-1 chunks,
+// which are only dispatched once enough workers are idle to execute all
+// chunks in parallel. Hence, chunks may synchronize with each other, for
+// instance using Barrier. Gang jobs are neither supported by the
+// LockFreeQueue nor by pools without worker threads
+func (t ThreadPool) AddGangJob(iFrom, iTo int, jobGroup int, f func(ifrom, ito int, pool ThreadPool, erf func() error) error) error {
+  if iFrom >= iTo {
+    return nil
+  }
+  if t.NumberOfThreads() == 1 {
+    return t.AddJob(jobGroup, func(pool ThreadPool, erf func() error) error {
+      return f(iFrom, iTo, pool, erf)
+    })
+  }
+  if t.lockFree || !t.hasWorkers() {
+    return errors.New("threadpool: gang jobs are not supported by this pool")
+  }
+  if err := t.checkGroup(jobGroup); err != nil {
+    return err
+  }
+  state := t.getJobGroup(jobGroup)
+  if t.dropped(state) {
+    // job group already failed, drop job
+    return ErrCancelled
+  }
+  m := t.NumberOfThreads()-1
+  if t.sub != nil && m > t.sub.limit {
+    m = t.sub.limit
+  }
+  if n := t.ActiveWorkers(); m > n {
+    m = n
+  }
+  if m > iTo-iFrom {
+    m = iTo-iFrom
+  }
+  t.recordParent(jobGroup, state)
+  index := state.nextIndex(m)
+  gang  := make([]job, m)
+  for k := 0; k < m; k++ {
+    iFrom_ := iFrom + k    *(iTo-iFrom)/m
+    iTo_   := iFrom + (k+1)*(iTo-iFrom)/m
+    gang[k] = job{f: func(pool ThreadPool, erf func() error) error {
+      defer state.barrier.leave()
+      return f(iFrom_, iTo_, pool, erf)
+    }, jobGroup: jobGroup, group: state, member: true, index: index+k}
+  }
+  state.wg.Add(m)
+  // the gang occupies a single slot in the queue and cannot
+  // be executed by the calling thread
+  if err := t.queue.push(job{jobGroup: jobGroup, group: state, gang: gang}); err != nil {
+    state.wg.Add(-m)
+    return err
+  }
+  t.wake()
+  t.watermarks.check(t.queue)
+  t.counters.add(counterSubmitted, m)
   return nil
 }
 
@@ -388,6 +1798,18 @@ func (t ThreadPool) Job(f func(pool ThreadPool, erf func() error) error) error {
   return nil
 }
 
+// Submit a single function and wait until it is done
+func (t ThreadPool) Func(f func() error) error {
+  g := t.NewJobGroup()
+  if err := t.AddFunc(g, f); err != nil {
+    return err
+  }
+  if err := t.Wait(g); err != nil {
+    return err
+  }
+  return nil
+}
+
 // Submit a range job and wait until the job is done
 func (t ThreadPool) RangeJob(iFrom, iTo int, f func(i int, pool ThreadPool, erf func() error) error) error {
   g := t.NewJobGroup()
@@ -411,32 +1833,376 @@ func (t ThreadPool) RangeJob_(iFrom, iTo int, f func(ifrom, ito int, pool Thread
   return nil
 }
 
+/* options
+ * -------------------------------------------------------------------------- */
+
+type Option func(*threadPool)
+
+// As soon as a job returns an error, remove all jobs of the same job
+// group that are still queued. Jobs submitted to a job group that
+// already failed are dropped and AddJob returns ErrCancelled
+func CancelOnError() Option {
+  return func(t *threadPool) {
+    t.cancelOnError = true
+  }
+}
+
+// Jobs are never executed by threads outside the pool, i.e. neither by
+// AddJob if the queue is full nor by Wait while waiting. If [wait] is true,
+// submission blocks until the job can be queued, otherwise ErrQueueFull is
+// returned. Jobs submitted by jobs are still executed by the submitting
+// thread if the queue is full, since it belongs to the pool. Pools without
+// workers ignore this option
+func WorkersOnly(wait bool) Option {
+  return func(t *threadPool) {
+    t.workersOnly     = true
+    t.workersOnlyWait = wait
+  }
+}
+
+// Limit the number of jobs that are nested on a thread to [n]. Jobs are
+// nested if a job calls Wait, which executes queued jobs while waiting, or
+// if a job submits jobs while the queue is full. Beyond this limit Wait
+// blocks without executing jobs and submission waits for space in the
+// queue, which prevents the stack from growing without bounds when jobs
+// recursively submit and wait for jobs. Since blocked jobs occupy their
+// threads, at most NumberOfThreads()*n jobs can wait at the same time.
+// Pools without worker threads, e.g. Serial pools, ignore the limit
+func MaxDepth(n int) Option {
+  return func(t *threadPool) {
+    t.maxDepth = n
+  }
+}
+
+// Jobs submitted after the pool was stopped are executed on the calling
+// thread instead of returning ErrStopped, and Wait no longer reports
+// ErrStopped. Gang jobs and asynchronous jobs are still rejected
+func SerialAfterStop() Option {
+  return func(t *threadPool) {
+    t.serialAfterStop = true
+  }
+}
+
+// If a job returns an error, cancel all descendants of its job group
+// that were created with NewChildJobGroup (see CancelJobGroup)
+func CancelChildren() Option {
+  return func(t *threadPool) {
+    t.cancelChildren = true
+  }
+}
+
+// Wait does not clear the state of a job group, so that it can be
+// waited on and inspected multiple times. The state must be released
+// with ClearJobGroup
+func KeepState() Option {
+  return func(t *threadPool) {
+    t.keepState = true
+  }
+}
+
+// Execute all jobs synchronously on the submitting thread in submission
+// order. The number of threads reported by the pool is not affected.
+// This mode is meant for debugging and can also be enabled by setting
+// the environment variable THREADPOOL_SERIAL=1
+func Serial() Option {
+  return func(t *threadPool) {
+    t.serial = true
+  }
+}
+
+// Deterministic scheduler for testing. No worker threads are started,
+// instead all queued jobs are executed by Wait on the calling thread in
+// a pseudo-random order that is fully determined by [seed]. Replaying
+// the seed reproduces the exact interleaving of jobs
+func Seed(seed int64) Option {
+  return func(t *threadPool) {
+    t.seeded = true
+    t.seed   = seed
+  }
+}
+
+// Do not start any worker threads. Queued jobs are only executed by
+// Wait and Step on the calling thread, which allows tests to control
+// exactly when jobs are run
+func Manual() Option {
+  return func(t *threadPool) {
+    t.manual = true
+  }
+}
+
+// Use a lock-free ring buffer as job queue, which reduces the overhead
+// of submitting very large numbers of small jobs. The queue capacity is
+// at least two. Queued jobs of failed job groups cannot be removed from
+// this queue, with the CancelOnError option they are dropped once they
+// are dequeued
+func LockFreeQueue() Option {
+  return func(t *threadPool) {
+    t.lockFree = true
+  }
+}
+
+// Idle workers poll the queue for duration [d] before they block. This
+// reduces the latency for workloads with short bursts of small jobs at
+// the cost of some idle CPU time
+func Spin(d time.Duration) Option {
+  return func(t *threadPool) {
+    t.spin = d
+  }
+}
+
+// Threads waiting for a job group only execute jobs of this group, so
+// that Wait is not delayed by unrelated long-running jobs. Finding jobs
+// of a group requires a linear scan of the queue. With the LockFreeQueue
+// option, waiting threads do not execute any jobs
+func TargetedWait() Option {
+  return func(t *threadPool) {
+    t.targeted = true
+  }
+}
+
+// Interleave jobs of different job groups instead of dispatching them in
+// FIFO order. The next job is taken from the group that was served least
+// recently, so that a small group finishes promptly even if a large group
+// was submitted first. Once [aging] jobs were dispatched since a job was
+// queued, it is dispatched in FIFO order. Not supported by the
+// LockFreeQueue
+func FairScheduling(aging int) Option {
+  return func(t *threadPool) {
+    t.fair  = true
+    t.aging = aging
+  }
+}
+
+// Dispatch the most recently queued job first. For recursive divide and
+// conquer algorithms this improves cache locality and bounds the number
+// of queued jobs. Combined with FairScheduling, the most recent job of
+// the selected job group is dispatched. Not supported by the
+// LockFreeQueue
+func LIFO() Option {
+  return func(t *threadPool) {
+    t.lifo = true
+  }
+}
+
+// Dispatch jobs of the job group with the earliest deadline first (see
+// SetDeadline), so that periodic computations meet their deadlines even
+// if large groups without deadline are queued. Jobs of groups without
+// deadline are dispatched according to the remaining options once no
+// job with a deadline is queued. Not supported by the LockFreeQueue
+func DeadlineScheduling() Option {
+  return func(t *threadPool) {
+    t.edf = true
+  }
+}
+
+// Record histograms of job execution times for each job group, where
+// [buckets] are the upper bounds of the histogram bins. Histograms are
+// kept until they are released with ClearHistograms, and can be queried
+// with Stats or WritePrometheus
+func Histograms(buckets ...time.Duration) Option {
+  return func(t *threadPool) {
+    t.histograms = newHistograms(buckets)
+  }
+}
+
+// Set thresholds of the health check, i.e. the pool is reported as unhealthy
+// if the queue is full for longer than [saturation], or if a job group has
+// pending jobs for longer than [waiting]. Zero disables the respective
+// check. By default, the thresholds are one and ten minutes
+func HealthThresholds(saturation, waiting time.Duration) Option {
+  return func(t *threadPool) {
+    t.saturation = saturation
+    t.waiting    = waiting
+  }
+}
+
+// If a job of a group panicked, Wait raises the panic again in the calling
+// goroutine instead of returning an error. The panic value is a
+// RePanicError, which includes the stack trace of the original panic
+func RePanic() Option {
+  return func(t *threadPool) {
+    t.rePanic = true
+  }
+}
+
+// Limit the number of outstanding jobs of each job group, i.e. jobs that
+// were submitted but are not yet done, to [n]. If the limit is reached,
+// AddJob blocks until a job of the group is done if [wait] is true, and
+// returns ErrQuotaExceeded otherwise. Jobs that are submitted by jobs of
+// the pool never block, they are executed immediately instead. Gang jobs
+// and asynchronous jobs are not subject to the limit
+func GroupQuota(n int, wait bool) Option {
+  return func(t *threadPool) {
+    t.quota     = n
+    t.quotaWait = wait
+  }
+}
+
+// Jobs can only be submitted to job groups that were obtained from
+// NewJobGroup, otherwise ErrUnknownGroup is returned. This catches the
+// use of hard-coded job groups
+func StrictGroups() Option {
+  return func(t *threadPool) {
+    t.strict = true
+  }
+}
+
+// Set the name of the pool, which is attached to the worker goroutines as
+// pprof label "threadpool" together with the label "worker" carrying the
+// thread id. Goroutine profiles, for instance obtained with
+// net/http/pprof, show which workers belong to which pool
+func Name(name string) Option {
+  return func(t *threadPool) {
+    t.name = name
+  }
+}
+
+// Record the stack of the thread that executed a job when the job returns
+// an error (see JobError). Since the job has already returned, the stack
+// shows how the job was executed, for instance by which call of Wait
+func ErrorStacks() Option {
+  return func(t *threadPool) {
+    t.errorStacks = true
+  }
+}
+
+// Call [hook] for every job whose execution takes at least [threshold]. If
+// [hook] is nil, slow jobs are logged with the standard logger
+func SlowJobs(threshold time.Duration, hook func(SlowJob)) Option {
+  return func(t *threadPool) {
+    if hook == nil {
+      hook = func(job SlowJob) {
+        log.Printf("threadpool: %v", job)
+      }
+    }
+    t.slowJobs    = threshold
+    t.slowJobHook = hook
+  }
+}
+
+// Let all workers exit once the pool was idle for [idle], i.e. no job
+// was queued or executed, which releases their stacks. Workers are
+// started again on the next submission. Unbuffered pools do not
+// hibernate
+func Hibernate(idle time.Duration) Option {
+  return func(t *threadPool) {
+    t.hibernate = idle
+  }
+}
+
+// Call [hook] at most once every [interval] if jobs were executed by the
+// submitting thread because the queue was full, which indicates that the
+// queue is too small. The hook receives the number of such jobs since its
+// last call and is called by the submitting thread
+func SaturationWarning(interval time.Duration, hook func(inline int64)) Option {
+  return func(t *threadPool) {
+    t.saturationInterval = interval
+    t.saturationHook     = hook
+  }
+}
+
+// Number of job groups that are expected to exist at the same time, which
+// is used to allocate the internal state of job groups in advance. Maps of
+// job groups are presized and the states of new groups are allocated in
+// batches, which avoids allocations in programs that create large numbers
+// of short-lived job groups. A batch is only released once all its groups
+// are cleared
+func ExpectedGroups(n int) Option {
+  return func(t *threadPool) {
+    t.expectedGroups = n
+  }
+}
+
+// Call [onHigh] once the number of queued jobs reaches [high], and [onLow]
+// once it drops to [low] afterwards, which allows producers to pause and
+// resume submitting jobs. The hooks are called alternately by the threads
+// that submit or remove jobs and must not submit jobs themselves. Either
+// hook may be nil
+func Watermarks(high, low int, onHigh, onLow func()) Option {
+  return func(t *threadPool) {
+    t.watermarks = &watermarks{high: high, low: low, onHigh: onHigh, onLow: onLow}
+  }
+}
+
+// Call [hook] every [interval] for each thread with its current state,
+// i.e. whether it is idle or since when it executes a job of which group.
+// This allows to monitor the liveness of long running computations
+func Heartbeat(interval time.Duration, hook func(ThreadSnapshot)) Option {
+  return func(t *threadPool) {
+    t.heartbeat     = interval
+    t.heartbeatHook = hook
+  }
+}
+
+// Publish counters of submitted, completed, failed and inline executed
+// jobs, as well as the length of the queue, as expvar variable [name]. The
+// name must be unique within the process
+func Expvar(name string) Option {
+  return func(t *threadPool) {
+    t.expvar = name
+  }
+}
+
 /* -------------------------------------------------------------------------- */
 
 func Nil() ThreadPool {
   return ThreadPool{}
 }
 
-func New(threads, bufsize int) ThreadPool {
+// Create a pool of [threads] threads, including the calling thread, with a
+// queue of size [bufsize]. If [threads] is not positive, the number of
+// threads is given by DefaultThreads. If [bufsize] is zero, jobs are not
+// buffered but handed over directly to idle workers, i.e. AddJob blocks
+// until a worker is free. Jobs submitted from within jobs are executed
+// by the submitting thread instead, which cannot deadlock. Use Nested to
+// create a pool within a job that reuses the workers of the enclosing pool
+func New(threads, bufsize int, options ...Option) ThreadPool {
   if threads < 1 {
-    panic("invalid number of threads")
+    threads = DefaultThreads()
   }
-  if bufsize < 1 {
+  if bufsize < 0 {
     panic("invalid bufsize")
   }
-  if threads == 1 {
-    return ThreadPool{}
-  }
   t := threadPool{}
   t.threads  = threads
-  t.bufsize  = bufsize
-  t.cntmtx   = new(sync.RWMutex)
+  t.bufsize  = int64(bufsize)
   t.cnt      = 0
-  t.wgmmtx   = new(sync.RWMutex)
-  t.wgm      = make(map[int]*waitGroup)
-  t.errmtx   = new(sync.RWMutex)
-  t.err      = make(map[int]error)
+  t.slot     = make(chan struct{}, 1)
+  t.scratch  = make([][]byte, threads)
+  t.activity = make([]threadActivity, threads)
+  t.sleeping = make([]int32, threads)
+  t.active   = int32(threads-1)
+  t.parkCond = sync.NewCond(&t.parkMtx)
+  t.serial   = os.Getenv("THREADPOOL_SERIAL") == "1"
+  t.saturation = time.Minute
+  t.waiting    = 10*time.Minute
+  for _, option := range options {
+    option(&t)
+  }
+  if w := t.watermarks; w != nil && w.low >= w.high {
+    panic("low watermark must be smaller than high watermark")
+  }
+  if t.expectedGroups < 0 {
+    panic("invalid number of groups")
+  }
+  // options are validated even if they have no effect
+  if threads == 1 {
+    return ThreadPool{}
+  }
+  for i := range t.groups {
+    t.groups[i].m = make(map[int]*jobGroupState, t.expectedGroups/jobGroupShards)
+    if t.expectedGroups > 0 {
+      t.groups[i].size = (t.expectedGroups+jobGroupShards-1)/jobGroupShards
+      t.groups[i].slab = make([]jobGroupSlot, t.groups[i].size)
+    }
+  }
+  if t.histograms != nil && t.expectedGroups > 0 {
+    t.histograms.m = make(map[int]*histogram, t.expectedGroups)
+  }
+  if t.expvar != "" {
+    t.publish(t.expvar)
+  }
   // create threads
   t.Start()
-  return ThreadPool{&t, 0}
+  return ThreadPool{threadPool: &t}
 }
@@ -23,7 +23,15 @@ package threadpool
 
 /* -------------------------------------------------------------------------- */
 
+import "bytes"
+import "context"
+import "errors"
 import "fmt"
+import "runtime"
+import "runtime/pprof"
+import "strings"
+import "sync"
+import "sync/atomic"
 import "testing"
 import "time"
 
@@ -167,6 +175,1292 @@ func TestTest5(t *testing.T) {
   }
 }
 
+func TestWaitGroup(t *testing.T) {
+
+  wg   := newWaitGroup()
+  done := make(chan struct{})
+
+  for k := 0; k < 10; k++ {
+    wg.Add(100)
+    for i := 0; i < 100; i++ {
+      go wg.Done()
+    }
+    go func() {
+      wg.Wait()
+      done <- struct{}{}
+    }()
+    <- done
+    if wg.Value() != 0 {
+      t.Error("test failed")
+    }
+  }
+}
+
+func TestCancelOnError(t *testing.T) {
+
+  p := New(2, 1000, CancelOnError())
+  g := p.NewJobGroup()
+
+  started := make(chan struct{})
+  fail    := make(chan struct{})
+  n       := int32(0)
+
+  p.AddJob(g, func(p ThreadPool, erf func() error) error {
+    close(started)
+    <- fail
+    return fmt.Errorf("job failed")
+  })
+  <- started
+  for i := 0; i < 100; i++ {
+    p.AddJob(g, func(p ThreadPool, erf func() error) error {
+      atomic.AddInt32(&n, 1)
+      time.Sleep(time.Millisecond)
+      return nil
+    })
+  }
+  close(fail)
+  if err := p.Wait(g); err == nil {
+    t.Error("test failed")
+  }
+  if n := atomic.LoadInt32(&n); n >= 100 {
+    t.Errorf("test failed: %d jobs executed", n)
+  }
+}
+
+func TestErrors(t *testing.T) {
+
+  p  := New(3, 100)
+  g1 := p.NewJobGroup()
+  g2 := p.NewJobGroup()
+
+  p.AddJob(g1, func(p ThreadPool, erf func() error) error {
+    return fmt.Errorf("error in group 1")
+  })
+  p.AddJob(g2, func(p ThreadPool, erf func() error) error {
+    return nil
+  })
+  if err := p.Wait(g2); err != nil {
+    t.Error("test failed")
+  }
+  // job of group 1 might still be running
+  for len(p.Errors()) == 0 {
+    time.Sleep(time.Millisecond)
+  }
+  if err, ok := p.Errors()[g1]; !ok || err == nil {
+    t.Error("test failed")
+  }
+  p.ClearErrors()
+  if len(p.Errors()) != 0 {
+    t.Error("test failed")
+  }
+  if err := p.Wait(g1); err != nil {
+    t.Error("test failed")
+  }
+}
+
+func TestKeepState(t *testing.T) {
+
+  p := New(3, 100, KeepState())
+  g := p.NewJobGroup()
+
+  p.AddJob(g, func(p ThreadPool, erf func() error) error {
+    return fmt.Errorf("error in job")
+  })
+  for i := 0; i < 2; i++ {
+    if err := p.Wait(g); err == nil {
+      t.Error("test failed")
+    }
+    if err := p.GroupError(g); err == nil {
+      t.Error("test failed")
+    }
+  }
+  p.ClearJobGroup(g)
+  if err := p.GroupError(g); err != nil {
+    t.Error("test failed")
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error("test failed")
+  }
+}
+
+func TestSerial(t *testing.T) {
+
+  p := New(5, 100, Serial())
+  g := p.NewJobGroup()
+  r := []int{}
+
+  for i_ := 0; i_ < 20; i_++ {
+    i := i_
+    if err := p.AddJob(g, func(p ThreadPool, erf func() error) error {
+      r = append(r, i)
+      if i == 10 {
+        return fmt.Errorf("error in job %d", i)
+      }
+      return nil
+    }); err != nil {
+      t.Error("test failed")
+    }
+  }
+  if err := p.Wait(g); err == nil {
+    t.Error("test failed")
+  }
+  if len(r) != 20 {
+    t.Errorf("test failed: %v", r)
+  }
+  for i := range r {
+    if r[i] != i {
+      t.Errorf("test failed: %v", r)
+      break
+    }
+  }
+  if p.NumberOfThreads() != 5 {
+    t.Error("test failed")
+  }
+}
+
+func TestSeed(t *testing.T) {
+
+  run := func(seed int64) []int {
+    p := New(5, 100, Seed(seed))
+    g := p.NewJobGroup()
+    r := []int{}
+    for i_ := 0; i_ < 20; i_++ {
+      i := i_
+      p.AddJob(g, func(p ThreadPool, erf func() error) error {
+        r = append(r, i)
+        return nil
+      })
+    }
+    if err := p.Wait(g); err != nil {
+      t.Error("test failed")
+    }
+    return r
+  }
+  r1 := run(42)
+  r2 := run(42)
+  if len(r1) != 20 || len(r2) != 20 {
+    t.Error("test failed")
+  }
+  for i := range r1 {
+    if r1[i] != r2[i] {
+      t.Errorf("test failed: %v != %v", r1, r2)
+      break
+    }
+  }
+}
+
+func TestPool(t *testing.T) {
+
+  sum := func(pool Pool, x []int) (int, error) {
+    r := make([]int, pool.NumberOfThreads())
+    g := pool.NewJobGroup()
+    if err := pool.AddRangeJob(0, len(x), g, func(i int, pool ThreadPool, erf func() error) error {
+      r[pool.GetThreadId()] += x[i]
+      return nil
+    }); err != nil {
+      return 0, err
+    }
+    if err := pool.Wait(g); err != nil {
+      return 0, err
+    }
+    s := 0
+    for _, ri := range r {
+      s += ri
+    }
+    return s, nil
+  }
+  for _, n := range []int{1, 5} {
+    if s, err := sum(New(n, 100), []int{1, 2, 3, 4, 5, 6}); err != nil || s != 21 {
+      t.Error("test failed")
+    }
+  }
+}
+
+func TestThreadId(t *testing.T) {
+
+  n := 4
+  p := New(n, 2)
+  // number of threads that currently use a given id
+  r := make([]int32, n)
+  e := int32(0)
+
+  job := func(p ThreadPool, erf func() error) error {
+    if atomic.AddInt32(&r[p.GetThreadId()], 1) != 1 {
+      atomic.StoreInt32(&e, 1)
+    }
+    time.Sleep(100 * time.Microsecond)
+    atomic.AddInt32(&r[p.GetThreadId()], -1)
+    return nil
+  }
+  done := make(chan struct{})
+  // submit jobs from multiple threads outside the pool
+  for k := 0; k < 4; k++ {
+    go func() {
+      g := p.NewJobGroup()
+      for i := 0; i < 20; i++ {
+        p.AddJob(g, func(p ThreadPool, erf func() error) error {
+          job(p, erf)
+          // nested jobs
+          g := p.NewJobGroup()
+          p.AddJob(g, job)
+          p.AddJob(g, job)
+          return p.Wait(g)
+        })
+      }
+      p.Wait(g)
+      done <- struct{}{}
+    }()
+  }
+  for k := 0; k < 4; k++ {
+    <- done
+  }
+  if e != 0 {
+    t.Error("test failed")
+  }
+}
+
+func TestScratchStop(t *testing.T) {
+
+  p := New(3, 10)
+  g := p.NewJobGroup()
+
+  started := make(chan struct{}, 2)
+  release := make(chan struct{})
+  for i := 0; i < 2; i++ {
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      started <- struct{}{}
+      for {
+        b := pool.Scratch(pool.GetThreadId(), 16)
+        b[0] = 1
+        select {
+        case <- release:
+          return nil
+        default:
+        }
+      }
+    })
+  }
+  <- started
+  <- started
+  // buffers of running jobs are not released
+  p.Stop()
+  close(release)
+  p.Wait(g)
+
+  // invalid thread ids receive a new buffer
+  if b := p.Scratch(-1, 8); len(b) != 8 {
+    t.Error("test failed")
+  }
+  if b := p.Scratch(3, 8); len(b) != 8 {
+    t.Error("test failed")
+  }
+}
+
+func TestScratch(t *testing.T) {
+
+  for _, n := range []int{1, 5} {
+    p := New(n, 100)
+    r := make([]int, 100)
+
+    if err := p.RangeJob(0, len(r), func(i int, p ThreadPool, erf func() error) error {
+      b := p.Scratch(p.GetThreadId(), i+1)
+      if len(b) != i+1 {
+        return fmt.Errorf("invalid buffer length")
+      }
+      for j := range b {
+        b[j] = 1
+      }
+      for _, x := range b {
+        r[i] += int(x)
+      }
+      return nil
+    }); err != nil {
+      t.Error(err)
+    }
+    for i := range r {
+      if r[i] != i+1 {
+        t.Error("test failed")
+      }
+    }
+    p.Stop()
+  }
+}
+
+func TestSpin(t *testing.T) {
+
+  p := New(5, 100, Spin(time.Millisecond))
+  r := make([]int, 100)
+
+  for k := 0; k < 10; k++ {
+    if err := p.RangeJob(0, len(r), func(i int, p ThreadPool, erf func() error) error {
+      r[i] += 1
+      return nil
+    }); err != nil {
+      t.Error(err)
+    }
+    time.Sleep(time.Duration(k) * 200 * time.Microsecond)
+  }
+  for i := range r {
+    if r[i] != 10 {
+      t.Error("test failed")
+    }
+  }
+  p.Stop()
+}
+
+func TestWaitHelping(t *testing.T) {
+
+  p := New(2, 100)
+  g := p.NewJobGroup()
+  n := 5
+  r := make([]int, n)
+
+  started := make(chan struct{})
+  done    := make(chan struct{}, n)
+  // the only worker executes this job, which submits more jobs
+  // after a while and blocks until they are done
+  p.AddJob(g, func(p ThreadPool, erf func() error) error {
+    close(started)
+    time.Sleep(10 * time.Millisecond)
+    for i_ := 0; i_ < n; i_++ {
+      i := i_
+      p.AddJob(g, func(p ThreadPool, erf func() error) error {
+        r[i] = p.GetThreadId()+1
+        done <- struct{}{}
+        return nil
+      })
+    }
+    for i := 0; i < n; i++ {
+      select {
+      case <- done:
+      case <- time.After(time.Second):
+        return fmt.Errorf("jobs were not executed")
+      }
+    }
+    return nil
+  })
+  <- started
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  for i := range r {
+    if r[i] != 1 {
+      t.Errorf("test failed: %v", r)
+      break
+    }
+  }
+}
+
+func TestTargetedWait(t *testing.T) {
+
+  p  := New(2, 100, TargetedWait())
+  g1 := p.NewJobGroup()
+  g2 := p.NewJobGroup()
+
+  started := make(chan struct{})
+  release := make(chan struct{})
+  // keep the only worker busy
+  p.AddJob(g1, func(p ThreadPool, erf func() error) error {
+    close(started)
+    <- release
+    return nil
+  })
+  <- started
+  // long running job of another group
+  p.AddJob(g1, func(p ThreadPool, erf func() error) error {
+    time.Sleep(500 * time.Millisecond)
+    return nil
+  })
+  r := 0
+  p.AddJob(g2, func(p ThreadPool, erf func() error) error {
+    r = p.GetThreadId()+1
+    return nil
+  })
+  t0 := time.Now()
+  if err := p.Wait(g2); err != nil {
+    t.Error(err)
+  }
+  if r != 1 || time.Since(t0) > 250*time.Millisecond {
+    t.Error("test failed")
+  }
+  close(release)
+  p.Wait(g1)
+}
+
+func TestLIFO(t *testing.T) {
+
+  p := New(5, 100, Manual(), LIFO())
+  g := p.NewJobGroup()
+  r := []int{}
+
+  for i_ := 0; i_ < 5; i_++ {
+    i := i_
+    p.AddJob(g, func(p ThreadPool, erf func() error) error {
+      r = append(r, i)
+      return nil
+    })
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  for i := range r {
+    if r[i] != 4-i {
+      t.Errorf("test failed: %v", r)
+      break
+    }
+  }
+}
+
+func TestDeadlineScheduling(t *testing.T) {
+
+  p  := New(5, 100, Manual(), DeadlineScheduling())
+  g0 := p.NewJobGroup()
+  g1 := p.NewJobGroup()
+  r  := []int{}
+
+  p.SetDeadline(g1, time.Now().Add(time.Second))
+
+  for _, g := range []int{g0, g0, g1, g1} {
+    g := g
+    p.AddJob(g, func(p ThreadPool, erf func() error) error {
+      r = append(r, g)
+      return nil
+    })
+  }
+  // jobs of g1 are dispatched first, so that Wait(g1)
+  // returns before any job of g0 is executed
+  if err := p.Wait(g1); err != nil {
+    t.Error(err)
+  }
+  if len(r) != 2 || r[0] != g1 || r[1] != g1 {
+    t.Errorf("test failed: %v", r)
+  }
+  if err := p.Wait(g0); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestWeightedRangeJob(t *testing.T) {
+
+  // triangular loop, iteration i has cost i
+  cost := func(i int) float64 { return float64(i) }
+
+  chunks := weightedChunks(0, 100, 4, cost)
+  if len(chunks) != 4 || chunks[0][0] != 0 || chunks[3][1] != 100 {
+    t.Errorf("test failed: %v", chunks)
+  }
+  for k, chunk := range chunks {
+    c := 0.0
+    for i := chunk[0]; i < chunk[1]; i++ {
+      c += cost(i)
+    }
+    if c < 1000 || c > 1400 {
+      t.Errorf("test failed: chunk %d has cost %f", k, c)
+    }
+    if k > 0 && chunks[k-1][1] != chunk[0] {
+      t.Errorf("test failed: %v", chunks)
+    }
+  }
+  // zero costs
+  if chunks := weightedChunks(0, 10, 4, func(i int) float64 { return 0 }); len(chunks) != 4 {
+    t.Errorf("test failed: %v", chunks)
+  }
+
+  p := New(5, 100)
+  g := p.NewJobGroup()
+  r := make([]int32, 100)
+
+  p.AddWeightedRangeJob(0, len(r), g, cost, func(i int, p ThreadPool, erf func() error) error {
+    atomic.AddInt32(&r[i], 1)
+    return nil
+  })
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  for i := range r {
+    if r[i] != 1 {
+      t.Error("test failed")
+    }
+  }
+}
+
+func TestAsyncJob(t *testing.T) {
+
+  p := New(2, 100)
+  g := p.NewJobGroup()
+
+  done, err := p.AddAsyncJob(g)
+  if err != nil {
+    t.Fatal(err)
+  }
+  go func() {
+    time.Sleep(10 * time.Millisecond)
+    done(fmt.Errorf("test error"))
+  }()
+  if err := p.Wait(g); err == nil {
+    t.Error("test failed")
+  }
+  if _, err := Nil().AddAsyncJob(0); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestSlowJobs(t *testing.T) {
+
+  r := make(chan SlowJob, 10)
+  p := New(2, 100, SlowJobs(10*time.Millisecond, func(job SlowJob) {
+    r <- job
+  }))
+  g := p.NewJobGroup()
+
+  for i := 0; i < 2; i++ {
+    i := i
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      if i == 1 {
+        time.Sleep(20*time.Millisecond)
+      }
+      return nil
+    })
+  }
+  p.Wait(g)
+  close(r)
+  n := 0
+  for job := range r {
+    if job.JobGroup != g || job.Duration < 20*time.Millisecond {
+      t.Errorf("test failed: %v", job)
+    }
+    n++
+  }
+  if n != 1 {
+    t.Error("test failed")
+  }
+}
+
+func TestAddFunc(t *testing.T) {
+
+  for _, p := range []ThreadPool{Nil(), New(3, 100)} {
+    n := int32(0)
+    g := p.NewJobGroup()
+    for i := 0; i < 10; i++ {
+      p.AddFunc(g, func() error {
+        atomic.AddInt32(&n, 1)
+        return nil
+      })
+    }
+    if err := p.Wait(g); err != nil || n != 10 {
+      t.Error("test failed")
+    }
+    if err := p.Func(func() error { return fmt.Errorf("test error") }); err == nil {
+      t.Error("test failed")
+    }
+  }
+}
+
+func TestContextJob(t *testing.T) {
+
+  p := New(3, 100)
+  g := p.NewJobGroup()
+
+  p.AddContextJob(g, func(ctx context.Context, pool ThreadPool) error {
+    return fmt.Errorf("test error")
+  })
+  p.AddContextJob(g, func(ctx context.Context, pool ThreadPool) error {
+    select {
+    case <- ctx.Done():
+      return nil
+    case <- time.After(time.Second):
+      return fmt.Errorf("context not cancelled")
+    }
+  })
+  if err := p.Wait(g); err == nil || err.Error() != "test error" {
+    t.Errorf("test failed: %v", err)
+  }
+  if err := Nil().AddContextJob(0, func(ctx context.Context, pool ThreadPool) error {
+    return ctx.Err()
+  }); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestGOMAXPROCS(t *testing.T) {
+  if n := New(0, 100).NumberOfThreads(); n != runtime.GOMAXPROCS(0) {
+    t.Errorf("test failed: %d", n)
+  }
+}
+
+func TestHandoff(t *testing.T) {
+
+  p := New(3, 0)
+  g := p.NewJobGroup()
+
+  release := make(chan struct{})
+  for i := 0; i < 2; i++ {
+    p.AddJob(g, func(p ThreadPool, erf func() error) error {
+      <- release
+      return nil
+    })
+  }
+  // both workers are busy, hence the next job cannot be
+  // handed over
+  submitted := make(chan struct{})
+  go func() {
+    p.AddJob(g, func(p ThreadPool, erf func() error) error {
+      // nested jobs are executed by this thread
+      g := p.NewJobGroup()
+      for i := 0; i < 10; i++ {
+        p.AddJob(g, func(p ThreadPool, erf func() error) error {
+          return nil
+        })
+      }
+      return p.Wait(g)
+    })
+    close(submitted)
+  }()
+  select {
+  case <- submitted:
+    t.Error("test failed")
+  case <- time.After(20 * time.Millisecond):
+  }
+  close(release)
+  <- submitted
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  p.Stop()
+}
+
+func TestSetBufferSize(t *testing.T) {
+
+  p := New(3, 2, Manual())
+  g := p.NewJobGroup()
+
+  for i := 0; i < 2; i++ {
+    p.AddFunc(g, func() error { return nil })
+  }
+  if err := p.SetBufferSize(10); err != nil {
+    t.Error(err)
+  }
+  for i := 0; i < 8; i++ {
+    p.AddFunc(g, func() error { return nil })
+  }
+  if s := p.Snapshot(); s.Queue != 10 || s.Capacity != 10 {
+    t.Errorf("test failed: %d/%d", s.Queue, s.Capacity)
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  if err := New(3, 0).SetBufferSize(10); err == nil {
+    t.Error("test failed")
+  }
+  if err := New(3, 10, LockFreeQueue()).SetBufferSize(20); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestAllocations(t *testing.T) {
+
+  p := New(4, 1000)
+  defer p.Stop()
+
+  f := func(pool ThreadPool, erf func() error) error {
+    return erf()
+  }
+  // submitting and executing jobs does not allocate, only
+  // the state of the job group is allocated
+  n := testing.AllocsPerRun(10, func() {
+    g := p.NewJobGroup()
+    for i := 0; i < 1000; i++ {
+      p.AddJob(g, f)
+    }
+    p.Wait(g)
+  })
+  if n > 20 {
+    t.Errorf("test failed: %v allocations", n)
+  }
+  // range jobs only allocate their chunks (more allocations are
+  // reported with the race detector, which drops pooled buffers)
+  g := p.NewJobGroup()
+  r := func(i int, pool ThreadPool, erf func() error) error {
+    return nil
+  }
+  n = testing.AllocsPerRun(100, func() {
+    p.AddRangeJob(0, 100, g, r)
+  })
+  if n > 8 {
+    t.Errorf("test failed: %v allocations", n)
+  }
+  p.Wait(g)
+}
+
+func TestGroupQuota(t *testing.T) {
+
+  for _, wait := range []bool{false, true} {
+    p := New(3, 100, GroupQuota(2, wait))
+    g := p.NewJobGroup()
+
+    release := make(chan struct{})
+    job     := func(pool ThreadPool, erf func() error) error {
+      <- release
+      return nil
+    }
+    for i := 0; i < 2; i++ {
+      if err := p.AddJob(g, job); err != nil {
+        t.Error(err)
+      }
+    }
+    // other groups are not affected
+    if err := p.AddJob(p.NewJobGroup(), job); err != nil {
+      t.Error(err)
+    }
+    if !wait {
+      if err := p.AddJob(g, job); err != ErrQuotaExceeded {
+        t.Errorf("test failed: %v", err)
+      }
+      close(release)
+    } else {
+      submitted := make(chan struct{})
+      go func() {
+        p.AddJob(g, job)
+        close(submitted)
+      }()
+      select {
+      case <- submitted:
+        t.Error("test failed")
+      case <- time.After(20 * time.Millisecond):
+      }
+      close(release)
+      <- submitted
+    }
+    if err := p.Wait(g); err != nil {
+      t.Error(err)
+    }
+    p.Stop()
+  }
+}
+
+func TestNewJobGroupConcurrent(t *testing.T) {
+
+  p := New(3, 100)
+  defer p.Stop()
+
+  // group 1 is in use, although it was not obtained from
+  // NewJobGroup
+  p.AddJob(1, func(pool ThreadPool, erf func() error) error {
+    time.Sleep(10*time.Millisecond)
+    return nil
+  })
+  r := make([][]int, 8)
+  g := p.NewJobGroup()
+  p.AddRangeJob(0, len(r), g, func(i int, pool ThreadPool, erf func() error) error {
+    for k := 0; k < 1000; k++ {
+      r[i] = append(r[i], pool.NewJobGroup())
+    }
+    return nil
+  })
+  p.Wait(g)
+  ids := map[int]bool{g: true}
+  for i := range r {
+    for _, id := range r[i] {
+      if ids[id] || id == 1 {
+        t.Fatalf("test failed: %d", id)
+      }
+      ids[id] = true
+    }
+  }
+  p.Wait(1)
+}
+
+func TestStrictGroups(t *testing.T) {
+
+  p := New(3, 100, StrictGroups())
+  defer p.Stop()
+
+  f := func(pool ThreadPool, erf func() error) error {
+    return nil
+  }
+  if err := p.AddJob(0, f); err != ErrUnknownGroup {
+    t.Errorf("test failed: %v", err)
+  }
+  g := p.NewJobGroup()
+  if err := p.AddJob(g, f); err != nil {
+    t.Error(err)
+  }
+  if err := p.AddRangeJob(0, 10, g+1, func(i int, pool ThreadPool, erf func() error) error {
+    return nil
+  }); err != ErrUnknownGroup {
+    t.Errorf("test failed: %v", err)
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestExpectedGroups(t *testing.T) {
+
+  p := New(3, 100, ExpectedGroups(1000), Histograms())
+  defer p.Stop()
+
+  gs := []int{}
+  for i := 0; i < 1000; i++ {
+    g := p.NewJobGroup()
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      return nil
+    })
+    gs = append(gs, g)
+  }
+  for _, g := range gs {
+    if err := p.Wait(g); err != nil {
+      t.Error(err)
+    }
+  }
+  if n := len(p.Stats().Histograms); n != 1000 {
+    t.Errorf("test failed: %d", n)
+  }
+  // states of new groups are allocated in batches
+  allocs := func(p ThreadPool) float64 {
+    return testing.AllocsPerRun(100, func() {
+      p.getJobGroup(p.NewJobGroup())
+    })
+  }
+  if a, b := allocs(New(3, 100, ExpectedGroups(1000))), allocs(New(3, 100)); a >= b {
+    t.Errorf("test failed: %v %v", a, b)
+  }
+  // options of single threaded pools are also validated
+  defer func() {
+    if recover() == nil {
+      t.Error("test failed")
+    }
+  }()
+  New(1, 100, ExpectedGroups(-1))
+}
+
+func TestTryWait(t *testing.T) {
+
+  p := New(2, 10, Manual())
+  g := p.NewJobGroup()
+
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    return nil
+  })
+  p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+    return fmt.Errorf("failed")
+  })
+  // jobs are not executed by the calling thread
+  if done, err := p.TryWait(g); done || err != nil || p.IsDone(g) {
+    t.Errorf("test failed: %v %v", done, err)
+  }
+  if n := p.Snapshot().Queue; n != 2 {
+    t.Errorf("test failed: %d", n)
+  }
+  p.Step()
+  if n := p.Remaining(g); n != 1 {
+    t.Errorf("test failed: %d", n)
+  }
+  p.Step()
+  if !p.IsDone(g) {
+    t.Error("test failed")
+  }
+  if done, err := p.TryWait(g); !done || err == nil {
+    t.Errorf("test failed: %v %v", done, err)
+  }
+  // state of the group was cleared
+  if done, err := p.TryWait(g); !done || err != nil {
+    t.Errorf("test failed: %v %v", done, err)
+  }
+}
+
+func TestRangeChunks(t *testing.T) {
+
+  p := New(3, 100)
+  defer p.Stop()
+
+  g := p.NewJobGroup()
+  r := make([]int, 10)
+  chunks, err := p.AddRangeJobChunks(0, 10, g, func(i int, pool ThreadPool, erf func() error) error {
+    r[i] = 1
+    return nil
+  })
+  if err != nil {
+    t.Error(err)
+  }
+  // the remainder of the range is an additional chunk
+  s := []Chunk{{0, 0, 3}, {1, 3, 6}, {2, 6, 9}, {3, 9, 10}}
+  if len(chunks) != len(s) {
+    t.Fatalf("test failed: %v", chunks)
+  }
+  for i := range s {
+    if chunks[i] != s[i] {
+      t.Errorf("test failed: %v", chunks)
+    }
+  }
+  p.Wait(g)
+  if len(p.RangeChunks(5, 5)) != 0 || len(p.RangeChunks(0, 2)) != 2 {
+    t.Error("test failed")
+  }
+}
+
+func TestName(t *testing.T) {
+
+  p := New(3, 100, Name("io"))
+  defer p.Stop()
+
+  labels := make(chan string, 1)
+  g      := p.NewJobGroup()
+  for i := 0; i < 10; i++ {
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      time.Sleep(time.Millisecond)
+      if pool.GetThreadId() != 0 {
+        buf := bytes.Buffer{}
+        pprof.Lookup("goroutine").WriteTo(&buf, 1)
+        select {
+        case labels <- buf.String():
+        default:
+        }
+      }
+      return nil
+    })
+  }
+  p.Wait(g)
+  select {
+  case s := <- labels:
+    if !strings.Contains(s, `"threadpool":"io"`) || !strings.Contains(s, `"worker":"`) {
+      t.Errorf("test failed: %s", s)
+    }
+  default:
+    t.Skip("no job was executed by a worker")
+  }
+  if p.Snapshot().Name != "io" {
+    t.Error("test failed")
+  }
+}
+
+func TestActiveWorkers(t *testing.T) {
+
+  p := New(4, 100)
+  defer p.Stop()
+  g := p.NewJobGroup()
+
+  if p.ActiveWorkers() != 3 {
+    t.Errorf("test failed: %d", p.ActiveWorkers())
+  }
+  p.SetActiveWorkers(1)
+
+  // idle workers execute at most one more job before they are
+  // parked, all other jobs are executed by worker 1 and the
+  // waiting thread
+  r := make([]int32, 4)
+  for i := 0; i < 20; i++ {
+    p.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      time.Sleep(time.Millisecond)
+      atomic.AddInt32(&r[pool.GetThreadId()], 1)
+      return nil
+    })
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  if r[2] > 1 || r[3] > 1 {
+    t.Errorf("test failed: %v", r)
+  }
+  p.SetActiveWorkers(10)
+  if p.ActiveWorkers() != 3 {
+    t.Errorf("test failed: %d", p.ActiveWorkers())
+  }
+}
+
+func TestSerialAfterStop(t *testing.T) {
+
+  p := New(3, 100, SerialAfterStop())
+  g := p.NewJobGroup()
+  p.Stop()
+
+  r := make([]int, 10)
+  if err := p.AddRangeJob(0, len(r), g, func(i int, pool ThreadPool, erf func() error) error {
+    r[i] = pool.GetThreadId()+1
+    return nil
+  }); err != nil {
+    t.Error(err)
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  for i := range r {
+    if r[i] != 1 {
+      t.Errorf("test failed: %v", r)
+    }
+  }
+}
+
+func TestMaxDepth(t *testing.T) {
+
+  p := New(4, 100, MaxDepth(2))
+  defer p.Stop()
+
+  depth := int32(0)
+  var f func(n int, pool ThreadPool) error
+  f = func(n int, pool ThreadPool) error {
+    if d := atomic.LoadInt32(&p.activity[pool.GetThreadId()].depth); d > atomic.LoadInt32(&depth) {
+      atomic.StoreInt32(&depth, d)
+    }
+    if n == 0 {
+      return nil
+    }
+    g := pool.NewJobGroup()
+    pool.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      return f(n-1, pool)
+    })
+    return pool.Wait(g)
+  }
+  if err := p.Job(func(pool ThreadPool, erf func() error) error {
+    return f(6, pool)
+  }); err != nil {
+    t.Error(err)
+  }
+  if depth > 2 {
+    t.Errorf("test failed: %d", depth)
+  }
+}
+
+func TestMaxDepthSerial(t *testing.T) {
+
+  p := New(4, 100, MaxDepth(1), Serial())
+
+  done := make(chan error, 1)
+  go func() {
+    var f func(n int, pool ThreadPool) error
+    f = func(n int, pool ThreadPool) error {
+      if n == 0 {
+        return nil
+      }
+      g := pool.NewJobGroup()
+      pool.AddJob(g, func(pool ThreadPool, erf func() error) error {
+        return f(n-1, pool)
+      })
+      return pool.Wait(g)
+    }
+    done <- p.Job(func(pool ThreadPool, erf func() error) error {
+      return f(3, pool)
+    })
+  }()
+  select {
+  case err := <-done:
+    if err != nil {
+      t.Error(err)
+    }
+  case <-time.After(5 * time.Second):
+    t.Fatal("deadlock")
+  }
+}
+
+func TestWorkersOnly(t *testing.T) {
+
+  for _, wait := range []bool{false, true} {
+    p := New(2, 1, WorkersOnly(wait))
+    g := p.NewJobGroup()
+
+    release := make(chan struct{})
+    r := make([]int32, 4)
+    f := func(pool ThreadPool, erf func() error) error {
+      <- release
+      atomic.AddInt32(&r[pool.GetThreadId()], 1)
+      return nil
+    }
+    // the first job blocks the worker, the second job is queued
+    p.AddJob(g, f)
+    time.Sleep(10*time.Millisecond)
+    p.AddJob(g, f)
+    if !wait {
+      if err := p.AddJob(g, f); err != ErrQueueFull {
+        t.Errorf("test failed: %v", err)
+      }
+      close(release)
+    } else {
+      time.AfterFunc(10*time.Millisecond, func() { close(release) })
+      if err := p.AddJob(g, f); err != nil {
+        t.Error(err)
+      }
+    }
+    if err := p.Wait(g); err != nil {
+      t.Error(err)
+    }
+    if r[0] != 0 {
+      t.Errorf("test failed: %v", r)
+    }
+    p.Stop()
+  }
+}
+
+func TestAddJobTimeout(t *testing.T) {
+
+  for _, p := range []ThreadPool{New(2, 2, Manual()), New(2, 2, Manual(), LockFreeQueue())} {
+    g := p.NewJobGroup()
+    f := func(pool ThreadPool, erf func() error) error {
+      return nil
+    }
+    p.AddJob(g, f)
+    p.AddJob(g, f)
+    start := time.Now()
+    if err := p.AddJobTimeout(g, 10*time.Millisecond, f); !errors.Is(err, ErrQueueFull) || !errors.Is(err, ErrTimeout) {
+      t.Errorf("test failed: %v", err)
+    }
+    if time.Since(start) < 10*time.Millisecond {
+      t.Error("test failed")
+    }
+    // space becomes available in time
+    time.AfterFunc(5*time.Millisecond, func() { p.Step() })
+    if err := p.AddJobTimeout(g, time.Second, f); err != nil {
+      t.Error(err)
+    }
+    if err := p.Wait(g); err != nil {
+      t.Error(err)
+    }
+  }
+}
+
+func TestAddJobTimeoutSerial(t *testing.T) {
+
+  p := New(2, 2, Serial())
+  g := p.NewJobGroup()
+  n := 0
+  for i := 0; i < 3; i++ {
+    if err := p.AddJobTimeout(g, time.Millisecond, func(pool ThreadPool, erf func() error) error {
+      n += 1
+      return nil
+    }); err != nil {
+      t.Error(err)
+    }
+  }
+  if err := p.Wait(g); err != nil || n != 3 {
+    t.Errorf("test failed: %v %d", err, n)
+  }
+}
+
+func TestAddJobWithKey(t *testing.T) {
+
+  p := New(5, 100)
+  g := p.NewJobGroup()
+
+  mtx := sync.Mutex{}
+  r   := map[string]map[int]bool{}
+  for i := 0; i < 100; i++ {
+    key := fmt.Sprintf("key%d", i % 10)
+    p.AddJobWithKey(g, key, func(pool ThreadPool, erf func() error) error {
+      time.Sleep(100*time.Microsecond)
+      mtx.Lock()
+      defer mtx.Unlock()
+      if r[key] == nil {
+        r[key] = map[int]bool{}
+      }
+      r[key][pool.GetThreadId()] = true
+      return nil
+    })
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  // all jobs of a key are executed by the same worker
+  for key, threads := range r {
+    if len(threads) != 1 || threads[0] {
+      t.Errorf("test failed: %s %v", key, threads)
+    }
+  }
+  // a job may wait for jobs pinned to its own worker
+  if err := p.Job(func(pool ThreadPool, erf func() error) error {
+    g := pool.NewJobGroup()
+    for i := 0; i < 10; i++ {
+      pool.AddJobWithKey(g, "key", func(pool ThreadPool, erf func() error) error {
+        return nil
+      })
+    }
+    return pool.Wait(g)
+  }); err != nil {
+    t.Error(err)
+  }
+  p.Stop()
+}
+
+func TestGangJobNestedWait(t *testing.T) {
+
+  p := New(3, 10)
+  g := p.NewJobGroup()
+  h := p.NewJobGroup()
+
+  started := make(chan struct{})
+  queued  := make(chan struct{})
+  // a running job that waits for a nested group while a gang job
+  // that cannot start is queued in front of the nested jobs
+  p.AddJob(g, func(p ThreadPool, erf func() error) error {
+    close(started)
+    <-queued
+    k := p.NewJobGroup()
+    p.AddJob(k, func(p ThreadPool, erf func() error) error {
+      time.Sleep(10 * time.Millisecond)
+      return nil
+    })
+    return p.Wait(k)
+  })
+  <-started
+  if err := p.AddGangJob(0, 2, h, func(iFrom, iTo int, p ThreadPool, erf func() error) error {
+    return nil
+  }); err != nil {
+    t.Error(err)
+  }
+  close(queued)
+
+  done := make(chan struct{})
+  go func() {
+    if err := p.Wait(g); err != nil {
+      t.Error(err)
+    }
+    if err := p.Wait(h); err != nil {
+      t.Error(err)
+    }
+    close(done)
+  }()
+  select {
+  case <-done:
+  case <-time.After(5 * time.Second):
+    t.Fatal("deadlock")
+  }
+}
+
+func TestGangJob(t *testing.T) {
+
+  p := New(5, 100)
+  g := p.NewJobGroup()
+
+  // keep some workers busy
+  for i := 0; i < 3; i++ {
+    p.AddJob(g, func(p ThreadPool, erf func() error) error {
+      time.Sleep(20 * time.Millisecond)
+      return nil
+    })
+  }
+  n := int32(0)
+  if err := p.AddGangJob(0, 100, g, func(iFrom, iTo int, p ThreadPool, erf func() error) error {
+    // barrier across all chunks
+    atomic.AddInt32(&n, 1)
+    for t0 := time.Now(); atomic.LoadInt32(&n) < 4; {
+      if time.Since(t0) > time.Second {
+        return fmt.Errorf("chunks did not start together")
+      }
+      runtime.Gosched()
+    }
+    return nil
+  }); err != nil {
+    t.Error(err)
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  if n != 4 {
+    t.Error("test failed")
+  }
+  if err := New(5, 100, LockFreeQueue()).AddGangJob(0, 10, 0, nil); err == nil {
+    t.Error("test failed")
+  }
+}
+
 /* -------------------------------------------------------------------------- */
 
 // Demonstrate AddJob
@@ -0,0 +1,64 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package threadpooltest provides a fake thread pool for deterministic
+// unit tests of code that submits jobs to a thread pool.
+package threadpooltest
+
+/* -------------------------------------------------------------------------- */
+
+import "github.com/pbenner/threadpool"
+
+/* -------------------------------------------------------------------------- */
+
+// Fake thread pool that does not execute any jobs on its own. Queued jobs
+// are executed on the calling thread when the test calls Step or RunAll,
+// or when the code under test calls Wait. Jobs submitted by other jobs are
+// queued in the same way. As with a regular pool, jobs are executed
+// immediately if the queue is full or if the pool has a single thread
+type Pool struct {
+  threadpool.ThreadPool
+}
+
+var _ threadpool.Pool = Pool{}
+
+/* -------------------------------------------------------------------------- */
+
+func New(threads, bufsize int) Pool {
+  return Pool{threadpool.New(threads, bufsize, threadpool.Manual())}
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Execute the next queued job. Returns false if no job was queued
+func (p Pool) Step() bool {
+  return p.ThreadPool.Step()
+}
+
+// Execute queued jobs until the queue is empty, including jobs that are
+// submitted while running. Returns the number of executed jobs
+func (p Pool) RunAll() int {
+  n := 0
+  for p.Step() {
+    n++
+  }
+  return n
+}
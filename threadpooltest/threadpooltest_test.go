@@ -0,0 +1,88 @@
+/* Copyright (C) 2017-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpooltest
+
+/* -------------------------------------------------------------------------- */
+
+import "fmt"
+import "testing"
+
+import "github.com/pbenner/threadpool"
+
+/* -------------------------------------------------------------------------- */
+
+func TestFake1(t *testing.T) {
+
+  p := New(5, 100)
+  g := p.NewJobGroup()
+  r := []int{}
+
+  for i_ := 0; i_ < 3; i_++ {
+    i := i_
+    p.AddJob(g, func(pool threadpool.ThreadPool, erf func() error) error {
+      r = append(r, i)
+      if i == 0 {
+        pool.AddJob(g, func(pool threadpool.ThreadPool, erf func() error) error {
+          r = append(r, 3)
+          return fmt.Errorf("error in job")
+        })
+      }
+      return nil
+    })
+  }
+  if len(r) != 0 {
+    t.Error("test failed")
+  }
+  if !p.Step() || len(r) != 1 {
+    t.Error("test failed")
+  }
+  if n := p.RunAll(); n != 3 || len(r) != 4 {
+    t.Errorf("test failed: %d jobs executed", n)
+  }
+  for i := range r {
+    if r[i] != i {
+      t.Errorf("test failed: %v", r)
+    }
+  }
+  if p.Step() {
+    t.Error("test failed")
+  }
+  if err := p.Wait(g); err == nil {
+    t.Error("test failed")
+  }
+}
+
+func TestFake2(t *testing.T) {
+
+  p := New(5, 100)
+  g := p.NewJobGroup()
+  n := 0
+
+  p.AddRangeJob(0, 10, g, func(i int, pool threadpool.ThreadPool, erf func() error) error {
+    n++
+    return nil
+  })
+  // Wait executes all remaining jobs
+  if err := p.Wait(g); err != nil || n != 10 {
+    t.Error("test failed")
+  }
+}
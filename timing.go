@@ -0,0 +1,143 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sort"
+import "sync"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Execution time of a job or of a chunk of a range job
+type ChunkTiming struct {
+  // range [From,To) of the chunk
+  From     int           `json:"from"`
+  To       int           `json:"to"`
+  ThreadId int           `json:"thread_id"`
+  Start    time.Time     `json:"start"`
+  Duration time.Duration `json:"duration"`
+}
+
+// Timing of a parallel section
+type Timing struct {
+  // wall time from submission until all jobs were done
+  Elapsed time.Duration `json:"elapsed"`
+  // execution times of all chunks ordered by their range
+  Chunks  []ChunkTiming `json:"chunks"`
+}
+
+type timingRecorder struct {
+  mtx    sync.Mutex
+  chunks []ChunkTiming
+}
+
+func (obj *timingRecorder) record(c ChunkTiming) {
+  obj.mtx.Lock()
+  obj.chunks = append(obj.chunks, c)
+  obj.mtx.Unlock()
+}
+
+func (obj *timingRecorder) timing(start time.Time) Timing {
+  obj.mtx.Lock()
+  defer obj.mtx.Unlock()
+  sort.Slice(obj.chunks, func(i, j int) bool {
+    return obj.chunks[i].From < obj.chunks[j].From
+  })
+  return Timing{Elapsed: time.Since(start), Chunks: obj.chunks}
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Same as Job, but also returns the elapsed wall time and the execution
+// time of the job, which is reported as a single chunk [0,1)
+func (t ThreadPool) TimedJob(f func(pool ThreadPool, erf func() error) error) (Timing, error) {
+  return t.TimedRangeJob_(0, 1, func(iFrom, iTo int, pool ThreadPool, erf func() error) error {
+    return f(pool, erf)
+  })
+}
+
+// Same as RangeJob, but also returns the elapsed wall time and the
+// execution time of each chunk
+func (t ThreadPool) TimedRangeJob(iFrom, iTo int, f func(i int, pool ThreadPool, erf func() error) error) (Timing, error) {
+  return t.TimedRangeJob_(iFrom, iTo, func(iFrom, iTo int, pool ThreadPool, erf func() error) error {
+    for i := iFrom; i < iTo; i++ {
+      if err := f(i, pool, erf); err != nil {
+        return rangeError{i, err}
+      }
+    }
+    return nil
+  })
+}
+
+func (t ThreadPool) TimedRangeJob_(iFrom, iTo int, f func(ifrom, ito int, pool ThreadPool, erf func() error) error) (Timing, error) {
+  r     := timingRecorder{}
+  start := time.Now()
+  err   := t.RangeJob_(iFrom, iTo, func(iFrom, iTo int, pool ThreadPool, erf func() error) error {
+    t0  := time.Now()
+    err := f(iFrom, iTo, pool, erf)
+    r.record(ChunkTiming{From: iFrom, To: iTo, ThreadId: pool.GetThreadId(), Start: t0, Duration: time.Since(t0)})
+    return err
+  })
+  return r.timing(start), err
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Result of a speedup measurement
+type Speedup struct {
+  Threads    int           `json:"threads"`
+  // wall time of the serial and of the parallel execution
+  Serial     time.Duration `json:"serial"`
+  Parallel   time.Duration `json:"parallel"`
+  // ratio of serial to parallel wall time, and speedup per thread
+  Speedup    float64       `json:"speedup"`
+  Efficiency float64       `json:"efficiency"`
+  // timing of the parallel execution
+  Timing     Timing        `json:"timing"`
+}
+
+// Execute the range job [f] first serially on the calling thread and then
+// with the pool as in RangeJob, and report the achieved speedup. This
+// helps choosing the number of threads and the size of jobs for a given
+// workload. In the serial execution, [f] receives a pool with a single
+// thread, i.e. jobs submitted by [f] are executed immediately
+func (t ThreadPool) MeasureSpeedup(iFrom, iTo int, f func(i int, pool ThreadPool, erf func() error) error) (Speedup, error) {
+  r := Speedup{Threads: t.NumberOfThreads()}
+  serial, err := ThreadPool{}.TimedRangeJob(iFrom, iTo, f)
+  if err != nil {
+    return r, err
+  }
+  parallel, err := t.TimedRangeJob(iFrom, iTo, f)
+  if err != nil {
+    return r, err
+  }
+  r.Serial   = serial.Elapsed
+  r.Parallel = parallel.Elapsed
+  r.Timing   = parallel
+  if r.Parallel > 0 {
+    r.Speedup    = float64(r.Serial)/float64(r.Parallel)
+    r.Efficiency = r.Speedup/float64(r.Threads)
+  }
+  return r, nil
+}
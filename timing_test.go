@@ -0,0 +1,87 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestTimedRangeJob(t *testing.T) {
+
+  p := New(3, 100)
+  defer p.Stop()
+
+  r, err := p.TimedRangeJob(0, 10, func(i int, pool ThreadPool, erf func() error) error {
+    time.Sleep(time.Millisecond)
+    return nil
+  })
+  if err != nil {
+    t.Error(err)
+  }
+  if len(r.Chunks) != 4 || r.Chunks[0].From != 0 || r.Chunks[3].To != 10 {
+    t.Errorf("test failed: %+v", r)
+  }
+  for i, c := range r.Chunks {
+    if i > 0 && c.From != r.Chunks[i-1].To {
+      t.Errorf("test failed: %+v", r)
+    }
+    if c.Duration < time.Duration(c.To-c.From)*time.Millisecond || c.Duration > r.Elapsed {
+      t.Errorf("test failed: %+v", r)
+    }
+  }
+}
+
+func TestTimedJob(t *testing.T) {
+
+  e := errors.New("job failed")
+  r, err := New(3, 100).TimedJob(func(pool ThreadPool, erf func() error) error {
+    time.Sleep(time.Millisecond)
+    return e
+  })
+  if !errors.Is(err, e) {
+    t.Error("test failed")
+  }
+  if len(r.Chunks) != 1 || r.Chunks[0].Duration < time.Millisecond || r.Elapsed < r.Chunks[0].Duration {
+    t.Errorf("test failed: %+v", r)
+  }
+}
+
+func TestMeasureSpeedup(t *testing.T) {
+
+  p := New(4, 100)
+  defer p.Stop()
+
+  r, err := p.MeasureSpeedup(0, 8, func(i int, pool ThreadPool, erf func() error) error {
+    time.Sleep(5*time.Millisecond)
+    return nil
+  })
+  if err != nil {
+    t.Error(err)
+  }
+  if r.Threads != 4 || r.Serial < 40*time.Millisecond || r.Speedup < 1.5 || r.Efficiency != r.Speedup/4 {
+    t.Errorf("test failed: %+v", r)
+  }
+}
@@ -0,0 +1,67 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "net/http"
+
+/* -------------------------------------------------------------------------- */
+
+// Round tripper that executes requests as jobs of a pool, so that the
+// number of outgoing requests is limited by the same budget as the
+// computations of the pool
+type transport struct {
+  pool ThreadPool
+  base http.RoundTripper
+}
+
+// Returns a round tripper that executes each request of [base] as a job of
+// the pool, i.e. a request occupies a thread of the pool until its response
+// header was received. If [base] is nil, http.DefaultTransport is used
+func (t ThreadPool) RoundTripper(base http.RoundTripper) http.RoundTripper {
+  if base == nil {
+    base = http.DefaultTransport
+  }
+  return transport{pool: t, base: base}
+}
+
+func (obj transport) RoundTrip(req *http.Request) (*http.Response, error) {
+  var resp *http.Response
+  err := obj.pool.Func(func() error {
+    // the request may have been cancelled while it was queued
+    if err := req.Context().Err(); err != nil {
+      return err
+    }
+    r, err := obj.base.RoundTrip(req)
+    resp = r
+    return err
+  })
+  if e, ok := Cause(err); ok {
+    // return the error of the base round tripper
+    err = e.Err
+  }
+  if err != nil {
+    return nil, err
+  }
+  return resp, nil
+}
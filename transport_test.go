@@ -0,0 +1,74 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "net/http"
+import "net/http/httptest"
+import "sync"
+import "sync/atomic"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestRoundTripper(t *testing.T) {
+
+  active := int32(0)
+  max    := int32(0)
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    n := atomic.AddInt32(&active, 1)
+    for m := atomic.LoadInt32(&max); n > m && !atomic.CompareAndSwapInt32(&max, m, n); {
+      m = atomic.LoadInt32(&max)
+    }
+    time.Sleep(5*time.Millisecond)
+    atomic.AddInt32(&active, -1)
+  }))
+  defer server.Close()
+
+  p := New(3, 100)
+  defer p.Stop()
+
+  client := http.Client{Transport: p.RoundTripper(nil)}
+  wg     := sync.WaitGroup{}
+  for i := 0; i < 20; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      resp, err := client.Get(server.URL)
+      if err != nil {
+        t.Error(err)
+        return
+      }
+      resp.Body.Close()
+    }()
+  }
+  wg.Wait()
+  // requests are executed by at most three threads
+  if max < 1 || max > 3 {
+    t.Errorf("test failed: %d", max)
+  }
+  if _, err := client.Get("http://127.0.0.1:0"); err == nil {
+    t.Error("test failed")
+  }
+}
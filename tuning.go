@@ -0,0 +1,194 @@
+//go:build go1.20
+// +build go1.20
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "math"
+import "runtime/metrics"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+// Bounds and thresholds of the controller enabled by AutoTune
+type Tuning struct {
+  // range of the number of active workers, zero values select one
+  // worker and all workers of the pool
+  Min        int
+  Max        int
+  // time between two adjustments, default is one second
+  Interval   time.Duration
+  // workers are removed if 90% of goroutines waited longer than this
+  // for being scheduled, default is one millisecond
+  MaxLatency time.Duration
+  // workers are only added if at least this fraction of the CPU time
+  // available to the process was idle, default is 0.1
+  MinIdle    float64
+}
+
+// Adjust the number of active workers every [config.Interval] within the
+// given bounds (see SetActiveWorkers). Workers are removed while goroutines
+// wait too long for being scheduled, which indicates that the host is
+// shared with other busy processes, and added again while jobs are queued
+// and the process has idle CPU time. Scheduler latencies and CPU times are
+// read from runtime/metrics
+func AutoTune(config Tuning) Option {
+  return func(t *threadPool) {
+    c := config
+    if c.Max < 1 || c.Max > t.threads-1 {
+      c.Max = t.threads-1
+    }
+    if c.Min < 1 {
+      c.Min = 1
+    }
+    if c.Min > c.Max {
+      c.Min = c.Max
+    }
+    if c.Interval <= 0 {
+      c.Interval = time.Second
+    }
+    if c.MaxLatency <= 0 {
+      c.MaxLatency = time.Millisecond
+    }
+    if c.MinIdle <= 0 {
+      c.MinIdle = 0.1
+    }
+    t.active     = int32(c.Max)
+    t.controller = func(q jobQueue) {
+      t.tune(q, c)
+    }
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Returns the number of active workers given the number [n] of currently
+// active workers, the scheduler latency, the fraction of idle CPU time
+// and the number of queued jobs
+func (c Tuning) next(n int, latency time.Duration, idle float64, queued int) int {
+  switch {
+  case latency > c.MaxLatency:
+    n -= 1
+  case latency <= c.MaxLatency/2 && idle >= c.MinIdle && queued > 0:
+    n += 1
+  }
+  if n < c.Min {
+    n = c.Min
+  }
+  if n > c.Max {
+    n = c.Max
+  }
+  return n
+}
+
+// Adjust the number of active workers until [q] is closed
+func (t *threadPool) tune(q jobQueue, c Tuning) {
+  samples := []metrics.Sample{
+    {Name: "/sched/latencies:seconds"},
+    {Name: "/cpu/classes/idle:cpu-seconds"},
+    {Name: "/cpu/classes/total:cpu-seconds"}}
+  metrics.Read(samples)
+  prev := tuningSample{}
+  prev.read(samples)
+  ticker := time.NewTicker(c.Interval)
+  defer ticker.Stop()
+  for range ticker.C {
+    if q.isClosed() {
+      return
+    }
+    metrics.Read(samples)
+    curr := tuningSample{}
+    curr.read(samples)
+    latency, idle := curr.since(prev)
+    prev = curr
+    if n := c.next(t.ActiveWorkers(), latency, idle, q.length()); n != t.ActiveWorkers() {
+      t.SetActiveWorkers(n)
+    }
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Values of runtime metrics at a point in time
+type tuningSample struct {
+  counts  []uint64
+  buckets []float64
+  idle    float64
+  total   float64
+}
+
+func (obj *tuningSample) read(samples []metrics.Sample) {
+  if samples[0].Value.Kind() == metrics.KindFloat64Histogram {
+    h := samples[0].Value.Float64Histogram()
+    obj.counts  = append([]uint64{}, h.Counts...)
+    obj.buckets = h.Buckets
+  }
+  if samples[1].Value.Kind() == metrics.KindFloat64 {
+    obj.idle = samples[1].Value.Float64()
+  }
+  if samples[2].Value.Kind() == metrics.KindFloat64 {
+    obj.total = samples[2].Value.Float64()
+  }
+}
+
+// Returns the 90th percentile of scheduler latencies and the fraction
+// of idle CPU time between [prev] and [obj]
+func (obj tuningSample) since(prev tuningSample) (time.Duration, float64) {
+  latency := time.Duration(0)
+  if len(prev.counts) == len(obj.counts) {
+    latency = latencyQuantile(obj.counts, prev.counts, obj.buckets, 0.9)
+  }
+  idle := 0.0
+  if total := obj.total - prev.total; total > 0 {
+    idle = (obj.idle - prev.idle)/total
+  }
+  return latency, idle
+}
+
+// Returns quantile [p] of the histogram of latencies given by the
+// difference of [counts] and [prev]
+func latencyQuantile(counts, prev []uint64, buckets []float64, p float64) time.Duration {
+  n := uint64(0)
+  for i := range counts {
+    n += counts[i] - prev[i]
+  }
+  if n == 0 {
+    return 0
+  }
+  k := uint64(math.Ceil(p*float64(n)))
+  m := uint64(0)
+  for i := range counts {
+    if m += counts[i] - prev[i]; m >= k {
+      // use the upper boundary of the bucket, unless it
+      // is unbounded
+      b := buckets[i+1]
+      if math.IsInf(b, 1) {
+        b = buckets[i]
+      }
+      return time.Duration(b*float64(time.Second))
+    }
+  }
+  return 0
+}
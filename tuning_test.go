@@ -0,0 +1,92 @@
+//go:build go1.20
+// +build go1.20
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "math"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestTuningNext(t *testing.T) {
+
+  c := Tuning{Min: 2, Max: 4, MaxLatency: time.Millisecond, MinIdle: 0.1}
+
+  if n := c.next(3, 2*time.Millisecond, 0.5, 10); n != 2 {
+    t.Errorf("test failed: %d", n)
+  }
+  if n := c.next(2, 2*time.Millisecond, 0.5, 10); n != 2 {
+    t.Errorf("test failed: %d", n)
+  }
+  if n := c.next(3, 100*time.Microsecond, 0.5, 10); n != 4 {
+    t.Errorf("test failed: %d", n)
+  }
+  if n := c.next(4, 100*time.Microsecond, 0.5, 10); n != 4 {
+    t.Errorf("test failed: %d", n)
+  }
+  // no spare CPU time or no queued jobs
+  if n := c.next(3, 100*time.Microsecond, 0.0, 10); n != 3 {
+    t.Errorf("test failed: %d", n)
+  }
+  if n := c.next(3, 100*time.Microsecond, 0.5, 0); n != 3 {
+    t.Errorf("test failed: %d", n)
+  }
+}
+
+func TestLatencyQuantile(t *testing.T) {
+
+  buckets := []float64{0, 0.001, 0.002, math.Inf(1)}
+
+  if d := latencyQuantile([]uint64{5, 5, 0}, []uint64{0, 0, 0}, buckets, 0.9); d != 2*time.Millisecond {
+    t.Errorf("test failed: %v", d)
+  }
+  if d := latencyQuantile([]uint64{10, 5, 0}, []uint64{5, 5, 0}, buckets, 0.9); d != time.Millisecond {
+    t.Errorf("test failed: %v", d)
+  }
+  if d := latencyQuantile([]uint64{0, 0, 3}, []uint64{0, 0, 0}, buckets, 0.9); d != 2*time.Millisecond {
+    t.Errorf("test failed: %v", d)
+  }
+}
+
+func TestAutoTune(t *testing.T) {
+
+  p := New(4, 100, AutoTune(Tuning{Min: 1, Max: 2, Interval: time.Millisecond}))
+  defer p.Stop()
+
+  if n := p.ActiveWorkers(); n < 1 || n > 2 {
+    t.Errorf("test failed: %d", n)
+  }
+  if err := p.RangeJob(0, 100, func(i int, pool ThreadPool, erf func() error) error {
+    time.Sleep(100*time.Microsecond)
+    return nil
+  }); err != nil {
+    t.Error(err)
+  }
+  if n := p.ActiveWorkers(); n < 1 || n > 2 {
+    t.Errorf("test failed: %d", n)
+  }
+}
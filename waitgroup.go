@@ -0,0 +1,83 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+// Runs functions on a pool and waits for them, which can replace a
+// sync.WaitGroup with goroutines. The zero value submits functions to the
+// default pool (see Default). A WaitGroup can be reused after Wait returned
+type WaitGroup struct {
+  mtx      sync.Mutex
+  pool     ThreadPool
+  jobGroup int
+  init     bool
+  // first error of a submission
+  err      error
+}
+
+// Returns a WaitGroup that submits functions to the pool
+func (t ThreadPool) WaitGroup() *WaitGroup {
+  return &WaitGroup{pool: t, jobGroup: t.NewJobGroup(), init: true}
+}
+
+func (wg *WaitGroup) get() (ThreadPool, int) {
+  wg.mtx.Lock()
+  defer wg.mtx.Unlock()
+  if !wg.init {
+    wg.pool     = Default()
+    wg.jobGroup = wg.pool.NewJobGroup()
+    wg.init     = true
+  }
+  return wg.pool, wg.jobGroup
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Submit [f] to the pool. Errors and panics of [f] are returned by Wait
+func (wg *WaitGroup) Go(f func() error) {
+  pool, jobGroup := wg.get()
+  if err := pool.AddFunc(jobGroup, f); err != nil {
+    wg.mtx.Lock()
+    if wg.err == nil {
+      wg.err = err
+    }
+    wg.mtx.Unlock()
+  }
+}
+
+// Wait until all functions are done and return the first error of a
+// submission or the error of the functions
+func (wg *WaitGroup) Wait() error {
+  pool, jobGroup := wg.get()
+  err := pool.Wait(jobGroup)
+  wg.mtx.Lock()
+  defer wg.mtx.Unlock()
+  if wg.err != nil {
+    err, wg.err = wg.err, nil
+  }
+  return err
+}
@@ -0,0 +1,176 @@
+//go:build go1.16
+// +build go1.16
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "io/fs"
+import "path"
+import "strings"
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+// State of a parallel walk. The error of the walk is the error of the path
+// that is visited first in lexical order, hence paths that come after this
+// path are no longer visited
+type walkState struct {
+  mtx     sync.Mutex
+  root    string
+  errPath string
+  err     error
+}
+
+// Returns the components of [name] below the root of the walk
+func (s *walkState) components(name string) []string {
+  if name == s.root {
+    return nil
+  }
+  if s.root != "." {
+    name = strings.TrimPrefix(name, s.root+"/")
+  }
+  return strings.Split(name, "/")
+}
+
+// True if [a] is visited before [b] by a sequential walk
+func (s *walkState) less(a, b string) bool {
+  x := s.components(a)
+  y := s.components(b)
+  for i := 0; i < len(x) && i < len(y); i++ {
+    if x[i] != y[i] {
+      return x[i] < y[i]
+    }
+  }
+  return len(x) < len(y)
+}
+
+// True if [name] must still be visited
+func (s *walkState) visit(name string) bool {
+  s.mtx.Lock()
+  defer s.mtx.Unlock()
+  return s.err == nil || s.less(name, s.errPath)
+}
+
+func (s *walkState) setError(name string, err error) {
+  s.mtx.Lock()
+  defer s.mtx.Unlock()
+  if s.err == nil || s.less(name, s.errPath) {
+    s.err, s.errPath = err, name
+  }
+}
+
+// Call [fn] for directory [name] and submit jobs for its sub-directories
+func (s *walkState) walkDir(pool ThreadPool, jobGroup int, fsys fs.FS, name string, d fs.DirEntry, fn fs.WalkDirFunc) {
+  if !s.visit(name) {
+    return
+  }
+  if err := fn(name, d, nil); err != nil {
+    if err != fs.SkipDir {
+      s.setError(name, err)
+    }
+    return
+  }
+  entries, err := fs.ReadDir(fsys, name)
+  if err != nil {
+    // report the error a second time as fs.WalkDir does
+    if err = fn(name, d, err); err != nil {
+      if err != fs.SkipDir {
+        s.setError(name, err)
+      }
+      return
+    }
+  }
+  for _, e := range entries {
+    name := path.Join(name, e.Name())
+    if !s.visit(name) {
+      return
+    }
+    if e.IsDir() {
+      e := e
+      if err := pool.AddJob(jobGroup, func(pool ThreadPool, erf func() error) error {
+        s.walkDir(pool, jobGroup, fsys, name, e, fn)
+        return nil
+      }); err != nil {
+        s.setError(name, err)
+        return
+      }
+      continue
+    }
+    if err := fn(name, e, nil); err != nil {
+      if err != fs.SkipDir {
+        s.setError(name, err)
+      }
+      // skip remaining entries of the directory
+      return
+    }
+  }
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Entry of the root of a walk
+type statDirEntry struct {
+  info fs.FileInfo
+}
+
+func (d statDirEntry) Name() string               { return d.info.Name() }
+func (d statDirEntry) IsDir() bool                { return d.info.IsDir() }
+func (d statDirEntry) Type() fs.FileMode          { return d.info.Mode().Type() }
+func (d statDirEntry) Info() (fs.FileInfo, error) { return d.info, nil }
+
+/* -------------------------------------------------------------------------- */
+
+// Walk the file tree rooted at [root] as fs.WalkDir, but visit directories
+// in parallel, where each directory is processed by a job of the pool. The
+// entries of a directory are visited in lexical order, but [fn] is called
+// concurrently for different directories and must be safe for concurrent
+// use. The returned error is the same as for a sequential walk, i.e. the
+// error of the path that comes first in lexical order. Once an error is
+// returned by [fn], only paths that come before this path are visited
+func WalkDir(pool ThreadPool, fsys fs.FS, root string, fn fs.WalkDirFunc) error {
+  s := walkState{root: root}
+  info, err := fs.Stat(fsys, root)
+  if err != nil {
+    err = fn(root, nil, err)
+  } else if !info.IsDir() {
+    err = fn(root, statDirEntry{info}, nil)
+  } else {
+    g := pool.NewJobGroup()
+    if err := pool.AddJob(g, func(pool ThreadPool, erf func() error) error {
+      s.walkDir(pool, g, fsys, root, statDirEntry{info}, fn)
+      return nil
+    }); err != nil {
+      s.setError(root, err)
+    }
+    if err := pool.Wait(g); err != nil {
+      return err
+    }
+    err = s.err
+  }
+  if err == fs.SkipDir {
+    return nil
+  }
+  return err
+}
@@ -0,0 +1,104 @@
+//go:build go1.16
+// +build go1.16
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "fmt"
+import "io/fs"
+import "sort"
+import "sync"
+import "testing"
+import "testing/fstest"
+
+/* -------------------------------------------------------------------------- */
+
+func TestWalkDir(t *testing.T) {
+
+  p := New(4, 100)
+  defer p.Stop()
+
+  fsys := fstest.MapFS{}
+  for _, name := range []string{"a/x", "a/y", "a/b/z", "b/x", "b/c/d/e", "c", "d/skip/x", "d/y"} {
+    fsys[name] = &fstest.MapFile{}
+  }
+  walk := func(fn fs.WalkDirFunc) ([]string, error) {
+    mtx := sync.Mutex{}
+    r   := []string{}
+    err := WalkDir(p, fsys, ".", func(name string, d fs.DirEntry, err error) error {
+      if err != nil {
+        return err
+      }
+      mtx.Lock()
+      r = append(r, name)
+      mtx.Unlock()
+      return fn(name, d, err)
+    })
+    sort.Strings(r)
+    return r, err
+  }
+  // compare with a sequential walk
+  for _, fail := range []string{"", "a/b/z", "b", "d/y"} {
+    fn := func(name string, d fs.DirEntry, err error) error {
+      if name == "d/skip" {
+        return fs.SkipDir
+      }
+      if name == fail || name == "c" && fail != "" {
+        return errors.New(name)
+      }
+      return nil
+    }
+    r1, err1 := walk(fn)
+    r2 := []string{}
+    err2 := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+      r2 = append(r2, name)
+      return fn(name, d, err)
+    })
+    sort.Strings(r2)
+    if fmt.Sprint(err1) != fmt.Sprint(err2) {
+      t.Errorf("test failed: %v %v", err1, err2)
+    }
+    // paths before the failed path are visited by both walks
+    if fail == "" && len(r1) != len(r2) {
+      t.Errorf("test failed: %v %v", r1, r2)
+    }
+  }
+}
+
+func TestWalkDirSubmitError(t *testing.T) {
+
+  // sub-directories cannot be submitted while the job of
+  // the root is running
+  p := New(4, 100, GroupQuota(1, false))
+  defer p.Stop()
+
+  fsys := fstest.MapFS{"a/x": &fstest.MapFile{}}
+  if err := WalkDir(p, fsys, ".", func(name string, d fs.DirEntry, err error) error {
+    return err
+  }); !errors.Is(err, ErrQuotaExceeded) {
+    t.Errorf("test failed: %v", err)
+  }
+}
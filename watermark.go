@@ -0,0 +1,71 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync"
+import "sync/atomic"
+
+/* -------------------------------------------------------------------------- */
+
+// Hooks that are called when the number of queued jobs crosses the high
+// or low watermark (see Watermarks)
+type watermarks struct {
+  mtx    sync.Mutex
+  high   int
+  low    int
+  onHigh func()
+  onLow  func()
+  // set after the high watermark was reached until the low watermark
+  // is reached, accessed atomically
+  above  int32
+}
+
+// Compare the length of [q] with the watermarks and call the hook if a
+// watermark was crossed. The length is checked again under the lock, so
+// that hooks are called alternately
+func (w *watermarks) check(q jobQueue) {
+  if w == nil {
+    return
+  }
+  n     := q.length()
+  above := atomic.LoadInt32(&w.above) != 0
+  if !above && n < w.high || above && n > w.low {
+    return
+  }
+  w.mtx.Lock()
+  defer w.mtx.Unlock()
+  n = q.length()
+  switch {
+  case atomic.LoadInt32(&w.above) == 0 && n >= w.high:
+    atomic.StoreInt32(&w.above, 1)
+    if w.onHigh != nil {
+      w.onHigh()
+    }
+  case atomic.LoadInt32(&w.above) != 0 && n <= w.low:
+    atomic.StoreInt32(&w.above, 0)
+    if w.onLow != nil {
+      w.onLow()
+    }
+  }
+}
@@ -0,0 +1,92 @@
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "testing"
+
+/* -------------------------------------------------------------------------- */
+
+func TestWatermarks(t *testing.T) {
+
+  r := []string{}
+  p := New(2, 10, Manual(), Watermarks(8, 2, func() {
+    r = append(r, "high")
+  }, func() {
+    r = append(r, "low")
+  }))
+  g := p.NewJobGroup()
+  f := func(pool ThreadPool, erf func() error) error {
+    return nil
+  }
+  for i := 0; i < 9; i++ {
+    p.AddJob(g, f)
+  }
+  if len(r) != 1 || r[0] != "high" {
+    t.Errorf("test failed: %v", r)
+  }
+  // queue drops to the low watermark
+  for i := 0; i < 7; i++ {
+    p.Step()
+  }
+  if len(r) != 2 || r[1] != "low" {
+    t.Errorf("test failed: %v", r)
+  }
+  p.AddJob(g, f)
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  if len(r) != 2 {
+    t.Errorf("test failed: %v", r)
+  }
+}
+
+func TestWatermarksSingleHook(t *testing.T) {
+
+  n := 0
+  p := New(2, 10, Manual(), Watermarks(4, 1, func() {
+    n += 1
+  }, nil))
+  g := p.NewJobGroup()
+  for i := 0; i < 5; i++ {
+    p.AddFunc(g, func() error { return nil })
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  for i := 0; i < 5; i++ {
+    p.AddFunc(g, func() error { return nil })
+  }
+  if err := p.Wait(g); err != nil {
+    t.Error(err)
+  }
+  if n != 2 {
+    t.Errorf("test failed: %d", n)
+  }
+  defer func() {
+    if recover() == nil {
+      t.Error("test failed")
+    }
+  }()
+  New(2, 10, Watermarks(1, 1, nil, nil))
+}
@@ -0,0 +1,207 @@
+//go:build go1.18
+// +build go1.18
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "sync"
+
+/* -------------------------------------------------------------------------- */
+
+// Typed facade of a pool for processing items of type T, where each item
+// is processed by a separate job. Items are submitted with Submit, and
+// Close waits until all items are processed (requires Go 1.18)
+type WorkerPool[T any] struct {
+  mtx      sync.Mutex
+  pool     ThreadPool
+  jobGroup int
+  process  func(T) error
+  closed   bool
+  // submissions in progress, which are waited for by Close
+  // without holding the lock, since [process] might be
+  // executed by Submit and submit further items
+  active   sync.WaitGroup
+}
+
+// Returns a worker pool that processes items with [process] on the
+// workers of [pool]
+func NewWorkerPool[T any](pool ThreadPool, process func(T) error) *WorkerPool[T] {
+  return &WorkerPool[T]{pool: pool, jobGroup: pool.NewJobGroup(), process: process}
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Submit [item] for processing. Returns ErrStopped if the worker pool was
+// closed. Errors of [process] are returned by Close, or by Submit if the
+// pool has only one thread
+func (w *WorkerPool[T]) Submit(item T) error {
+  w.mtx.Lock()
+  if w.closed {
+    w.mtx.Unlock()
+    return ErrStopped
+  }
+  w.active.Add(1)
+  w.mtx.Unlock()
+  defer w.active.Done()
+  return w.pool.AddJob(w.jobGroup, func(pool ThreadPool, erf func() error) error {
+    return w.process(item)
+  })
+}
+
+// Wait until all submitted items are processed and return the first
+// error of [process]. Further items are rejected. The underlying pool
+// is not stopped
+func (w *WorkerPool[T]) Close() error {
+  w.mtx.Lock()
+  w.closed = true
+  w.mtx.Unlock()
+  w.active.Wait()
+  return w.pool.Wait(w.jobGroup)
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Typed facade of a pool for processing items of type T into results of
+// type R, which are emitted on the output channel in the order in which
+// the items were submitted. Results that are done early are buffered until
+// all preceding results were emitted (requires Go 1.18)
+type OrderedWorkerPool[T, R any] struct {
+  mtx       sync.Mutex
+  cond      sync.Cond
+  pool      ThreadPool
+  jobGroup  int
+  process   func(T) (R, error)
+  closed    bool
+  // number of submitted items and results that were not yet
+  // emitted indexed by submission order
+  submitted int
+  results   map[int]orderedResult[R]
+  output    chan R
+}
+
+type orderedResult[R any] struct {
+  value R
+  // false if the item failed
+  ok    bool
+}
+
+// Returns a worker pool that processes items with [process] on the
+// workers of [pool]. A goroutine forwards results to Output until the
+// worker pool is closed, hence Close must always be called. Results must
+// be received from Output concurrently with Submit, otherwise the results
+// of all submitted items are buffered
+func NewOrderedWorkerPool[T, R any](pool ThreadPool, process func(T) (R, error)) *OrderedWorkerPool[T, R] {
+  w := OrderedWorkerPool[T, R]{pool: pool, jobGroup: pool.NewJobGroup(), process: process}
+  w.cond.L   = &w.mtx
+  w.results  = make(map[int]orderedResult[R])
+  w.output   = make(chan R)
+  go w.forward()
+  return &w
+}
+
+/* -------------------------------------------------------------------------- */
+
+// Returns the channel of results, which is closed once the pool was closed
+// and all results were emitted. Items for which [process] failed do not
+// have a result
+func (w *OrderedWorkerPool[T, R]) Output() <-chan R {
+  return w.output
+}
+
+// Submit [item] for processing. Returns ErrStopped if the worker pool was
+// closed. Errors of [process] are returned by Close, or by Submit if the
+// pool has only one thread
+func (w *OrderedWorkerPool[T, R]) Submit(item T) error {
+  w.mtx.Lock()
+  if w.closed {
+    w.mtx.Unlock()
+    return ErrStopped
+  }
+  i := w.submitted
+  w.submitted += 1
+  w.mtx.Unlock()
+  // the result is recorded once the job is finished or dropped
+  r    := orderedResult[R]{}
+  once := sync.Once{}
+  done := func() {
+    once.Do(func() { w.done(i, r) })
+  }
+  err := w.pool.addJob(w.jobGroup, job{finish: done, f: func(pool ThreadPool, erf func() error) error {
+    v, err := w.process(item)
+    if err == nil {
+      r = orderedResult[R]{value: v, ok: true}
+    }
+    return err
+  }})
+  if err != nil || w.pool.NumberOfThreads() == 1 {
+    // job was either executed at submission or not submitted
+    done()
+  }
+  return err
+}
+
+// Wait until all submitted items are processed and return the first
+// error of [process]. Further items are rejected. The underlying pool is
+// not stopped. Close must be called to release the goroutine that forwards
+// results, which exits once all results were received from Output
+func (w *OrderedWorkerPool[T, R]) Close() error {
+  w.mtx.Lock()
+  w.closed = true
+  w.cond.Broadcast()
+  w.mtx.Unlock()
+  return w.pool.Wait(w.jobGroup)
+}
+
+func (w *OrderedWorkerPool[T, R]) done(i int, r orderedResult[R]) {
+  w.mtx.Lock()
+  w.results[i] = r
+  w.cond.Broadcast()
+  w.mtx.Unlock()
+}
+
+// Emit results in submission order until the pool is closed and all
+// results were emitted
+func (w *OrderedWorkerPool[T, R]) forward() {
+  defer close(w.output)
+  w.mtx.Lock()
+  defer w.mtx.Unlock()
+  for next := 0; ; {
+    r, ok := w.results[next]
+    if !ok {
+      if w.closed && next == w.submitted {
+        return
+      }
+      w.cond.Wait()
+      continue
+    }
+    delete(w.results, next)
+    next += 1
+    if r.ok {
+      w.mtx.Unlock()
+      w.output <- r.value
+      w.mtx.Lock()
+    }
+  }
+}
@@ -0,0 +1,147 @@
+//go:build go1.18
+// +build go1.18
+
+/* Copyright (C) 2016-2023 Philipp Benner
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package threadpool
+
+/* -------------------------------------------------------------------------- */
+
+import "errors"
+import "sync/atomic"
+import "testing"
+import "time"
+
+/* -------------------------------------------------------------------------- */
+
+func TestWorkerPool(t *testing.T) {
+
+  for _, n := range []int{1, 3} {
+    p := New(n, 100)
+    s := int64(0)
+    w := NewWorkerPool(p, func(item int) error {
+      atomic.AddInt64(&s, int64(item))
+      return nil
+    })
+    for i := 1; i <= 100; i++ {
+      if err := w.Submit(i); err != nil {
+        t.Error(err)
+      }
+    }
+    if err := w.Close(); err != nil {
+      t.Error(err)
+    }
+    if s != 5050 {
+      t.Errorf("test failed: %d", s)
+    }
+    if err := w.Submit(1); !errors.Is(err, ErrStopped) {
+      t.Errorf("test failed: %v", err)
+    }
+    p.Stop()
+  }
+}
+
+func TestWorkerPoolReentrant(t *testing.T) {
+
+  // items are processed by Submit
+  p := New(3, 100, Serial())
+
+  var w *WorkerPool[int]
+  started := make(chan struct{})
+  release := make(chan struct{})
+  w = NewWorkerPool(p, func(item int) error {
+    if item == 0 {
+      close(started)
+      <-release
+      // submit while Close is waiting
+      w.Submit(1)
+    }
+    return nil
+  })
+  go w.Submit(0)
+  <-started
+  done := make(chan error, 1)
+  go func() {
+    done <- w.Close()
+  }()
+  time.Sleep(10*time.Millisecond)
+  close(release)
+  select {
+  case err := <-done:
+    if err != nil {
+      t.Error(err)
+    }
+  case <-time.After(5 * time.Second):
+    t.Fatal("deadlock")
+  }
+}
+
+func TestOrderedWorkerPool(t *testing.T) {
+
+  for _, n := range []int{1, 3} {
+    p := New(n, 100)
+    w := NewOrderedWorkerPool(p, func(item int) (int, error) {
+      // later items finish first
+      time.Sleep(time.Duration(100-item)*10*time.Microsecond)
+      if item == 50 {
+        return 0, errors.New("item failed")
+      }
+      return 2*item, nil
+    })
+    r := make(chan []int)
+    go func() {
+      s := []int{}
+      for v := range w.Output() {
+        s = append(s, v)
+      }
+      r <- s
+    }()
+    // the error is returned by Submit if the pool has only one thread
+    failed := 0
+    for i := 0; i < 100; i++ {
+      if w.Submit(i) != nil {
+        failed++
+      }
+    }
+    if w.Close() != nil {
+      failed++
+    }
+    if failed != 1 {
+      t.Error("test failed")
+    }
+    s := <- r
+    if len(s) != 99 {
+      t.Errorf("test failed: %v", s)
+    }
+    for i, j := 0, 0; i < 100; i++ {
+      if i == 50 {
+        continue
+      }
+      if s[j] != 2*i {
+        t.Errorf("test failed: %v", s)
+        break
+      }
+      j++
+    }
+    p.Stop()
+  }
+}